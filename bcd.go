@@ -0,0 +1,220 @@
+package struc
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BCD types, like fixed-point types, hold their format in the Type, as
+// bcdBase | signed<<9 | unpacked<<8 | digits.
+const (
+	bcdBase     Type = 1 << 17
+	bcdUnpacked Type = 1 << 8
+	bcdSigned   Type = 1 << 9
+)
+
+// bcdRe matches BCD type names, `bcd` with two digits to a byte or `ubcd`
+// with one, followed by an optional number of digits such as `bcd6`.
+var bcdRe = regexp.MustCompile(`^(u?bcd)(\d*)$`)
+
+// parseBCD parses the name of a BCD type.
+func parseBCD(name string) (Type, bool) {
+	m := bcdRe.FindStringSubmatch(name)
+	if m == nil {
+		return Invalid, false
+	}
+	typ := bcdBase
+	digits := 2
+	if m[1] == "ubcd" {
+		typ |= bcdUnpacked
+		digits = 1
+	}
+	if m[2] != "" {
+		var err error
+		if digits, err = strconv.Atoi(m[2]); err != nil || digits < 1 || digits > 0xff {
+			return Invalid, false
+		}
+	}
+	return typ | Type(digits), true
+}
+
+func (t Type) isBCD() bool {
+	return t >= bcdBase && t < bcdBase<<1
+}
+
+// bcdFormat returns the number of digits of a BCD type and whether it is
+// unpacked or has a sign nibble.
+func (t Type) bcdFormat() (digits int, unpacked, signed bool) {
+	return int(t & 0xff), t&bcdUnpacked != 0, t&bcdSigned != 0
+}
+
+// bcdSize returns the size in bytes of a BCD type.
+func (t Type) bcdSize() int {
+	digits, unpacked, signed := t.bcdFormat()
+	if unpacked {
+		return digits
+	} else if signed {
+		digits++
+	}
+	return (digits + 1) / 2
+}
+
+func (t Type) bcdName() string {
+	digits, unpacked, signed := t.bcdFormat()
+	name := fmt.Sprintf("bcd%d", digits)
+	if unpacked {
+		name = "u" + name
+	}
+	if signed {
+		name += ",sign"
+	}
+	return name
+}
+
+// bcdDigits returns the digits of the integer or numeric string val, padded
+// with zeros to the width of typ, and whether it is negative.
+func (f *Field) bcdDigits(val reflect.Value, typ Type) (string, bool, error) {
+	width, _, signed := typ.bcdFormat()
+	var s string
+	neg := false
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := val.Int()
+		u := uint64(n)
+		if n < 0 {
+			neg, u = true, -u
+		}
+		s = strconv.FormatUint(u, 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = strconv.FormatUint(val.Uint(), 10)
+	default:
+		s = val.String()
+		if signed && s != "" && (s[0] == '-' || s[0] == '+') {
+			neg, s = s[0] == '-', s[1:]
+		}
+		for i := 0; i < len(s); i++ {
+			if s[i] < '0' || s[i] > '9' {
+				return "", false, fmt.Errorf("struc: field %s holds %q, which is not a decimal number", f.Name, val.String())
+			}
+		}
+	}
+	if neg && !signed {
+		return "", false, fmt.Errorf("struc: field %s holds negative value %s, but has no sign nibble", f.Name, s)
+	}
+	if len(s) > width {
+		return "", false, fmt.Errorf("struc: field %s holds %s, more than %d digits", f.Name, s, width)
+	}
+	return strings.Repeat("0", width-len(s)) + s, neg, nil
+}
+
+// packBCD packs the integer or numeric string val into buf as the BCD type
+// typ. A sign nibble holds 0xC for positive and 0xD for negative values.
+func (f *Field) packBCD(buf []byte, val reflect.Value, typ Type) (int, error) {
+	digits, neg, err := f.bcdDigits(val, typ)
+	if err != nil {
+		return 0, err
+	}
+	_, unpacked, signed := typ.bcdFormat()
+	size := typ.bcdSize()
+	if unpacked {
+		for i := 0; i < size; i++ {
+			buf[i] = digits[i] - '0'
+		}
+		return size, nil
+	}
+	nibbles := make([]byte, 0, 2*size)
+	// an odd number of nibbles leaves the first one zero
+	pad := 2*size - len(digits)
+	if signed {
+		pad--
+	}
+	for ; pad > 0; pad-- {
+		nibbles = append(nibbles, 0)
+	}
+	for i := 0; i < len(digits); i++ {
+		nibbles = append(nibbles, digits[i]-'0')
+	}
+	if signed && neg {
+		nibbles = append(nibbles, 0xd)
+	} else if signed {
+		nibbles = append(nibbles, 0xc)
+	}
+	for i := 0; i < size; i++ {
+		buf[i] = nibbles[2*i]<<4 | nibbles[2*i+1]
+	}
+	return size, nil
+}
+
+// unpackBCD unpacks the BCD type typ from buf into the integer or string val,
+// returning an error if a nibble is not a decimal digit. Sign nibbles 0xB
+// and 0xD are negative, and 0xA, 0xC, 0xE and 0xF positive.
+func (f *Field) unpackBCD(buf []byte, val reflect.Value, typ Type) error {
+	_, unpacked, signed := typ.bcdFormat()
+	var nibbles []byte
+	for _, b := range buf[:typ.bcdSize()] {
+		if unpacked {
+			nibbles = append(nibbles, b)
+		} else {
+			nibbles = append(nibbles, b>>4, b&0xf)
+		}
+	}
+	neg := false
+	if signed {
+		sign := nibbles[len(nibbles)-1]
+		switch sign {
+		case 0xb, 0xd:
+			neg = true
+		case 0xa, 0xc, 0xe, 0xf:
+		default:
+			return fmt.Errorf("struc: BCD field %s has invalid sign nibble %#x", f.Name, sign)
+		}
+		nibbles = nibbles[:len(nibbles)-1]
+	}
+	digits := make([]byte, len(nibbles))
+	for i, n := range nibbles {
+		if n > 9 {
+			return fmt.Errorf("struc: BCD field %s holds invalid digit %#x", f.Name, n)
+		}
+		digits[i] = '0' + n
+	}
+	if width, _, _ := typ.bcdFormat(); len(digits) > width {
+		if digits[0] != '0' {
+			return fmt.Errorf("struc: BCD field %s has non-zero pad nibble %#x", f.Name, nibbles[0])
+		}
+		digits = digits[1:]
+	}
+	if val.Kind() == reflect.String {
+		s := string(digits)
+		if neg {
+			s = "-" + s
+		}
+		val.SetString(s)
+		return nil
+	}
+	u, err := strconv.ParseUint(string(digits), 10, 64)
+	if err == nil {
+		switch val.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n := int64(u)
+			if neg {
+				n = -n
+			}
+			if u <= 1<<63-1 && !val.OverflowInt(n) {
+				val.SetInt(n)
+				return nil
+			}
+		default:
+			if !neg && !val.OverflowUint(u) {
+				val.SetUint(u)
+				return nil
+			}
+		}
+	}
+	if neg {
+		return fmt.Errorf("struc: BCD value -%s overflows field %s", digits, f.Name)
+	}
+	return fmt.Errorf("struc: BCD value %s overflows field %s", digits, f.Name)
+}
@@ -0,0 +1,103 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type bcdRecord struct {
+	Clock   [3]uint8 `struc:"[3]bcd"`
+	Amount  int32    `struc:"bcd5,sign"`
+	Balance int64    `struc:"bcd4,sign"`
+	Serial  string   `struc:"bcd6"`
+	Code    uint16   `struc:"ubcd4"`
+	Delta   string   `struc:"bcd3,sign"`
+}
+
+func TestBCD(t *testing.T) {
+	in := &bcdRecord{
+		Clock:   [3]uint8{59, 30, 23},
+		Amount:  -12345,
+		Balance: 123,
+		Serial:  "012345",
+		Code:    1234,
+		Delta:   "-042",
+	}
+	want := []byte{
+		0x59, 0x30, 0x23,
+		0x12, 0x34, 0x5d,
+		0x00, 0x12, 0x3c,
+		0x01, 0x23, 0x45,
+		0x01, 0x02, 0x03, 0x04,
+		0x04, 0x2d,
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	if size, _ := Sizeof(in); size != len(want) {
+		t.Fatalf("bad size %d", size)
+	}
+	out := &bcdRecord{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %+v\nwant: %+v", out, in)
+	}
+}
+
+func TestBCDErrors(t *testing.T) {
+	type packed struct {
+		A int `struc:"bcd4"`
+	}
+	type signed struct {
+		A int8 `struc:"bcd3,sign"`
+	}
+	type str struct {
+		A string `struc:"bcd4"`
+	}
+	for _, data := range []interface{}{
+		&packed{10000},
+		&packed{-1},
+		&str{"12a4"},
+		&str{"12345"},
+	} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, data); err == nil {
+			t.Fatalf("%+v: packed without error", data)
+		}
+	}
+	type odd struct {
+		A int `struc:"bcd3"`
+	}
+	for _, test := range []struct {
+		data interface{}
+		in   []byte
+	}{
+		{&packed{}, []byte{0x12, 0x3a}},
+		// four digits in a three digit field
+		{&odd{}, []byte{0x12, 0x34}},
+		{&signed{}, []byte{0x12, 0x37}},
+		{&signed{}, []byte{0x99, 0x9c}},
+	} {
+		if err := Unpack(bytes.NewReader(test.in), test.data); err == nil {
+			t.Fatalf("%#v: unpacked without error", test.in)
+		}
+	}
+	type floatBCD struct {
+		A float64 `struc:"bcd4"`
+	}
+	type unpackedSign struct {
+		A int `struc:"ubcd4,sign"`
+	}
+	for _, data := range []interface{}{&floatBCD{}, &unpackedSign{}} {
+		if err := parseTest(data); err == nil {
+			t.Fatalf("%T: parsed without error", data)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package struc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// checkBitField validates a field tagged with bits=N. Bit-fields must be
+// scalar integers (or bools) that fit inside their declared storage type.
+func checkBitField(f *Field) error {
+	switch f.Type {
+	case Bool, Int8, Uint8, Int16, Uint16, Int32, Uint32, Int64, Uint64,
+		Int24, Uint24, Int40, Uint40, Int48, Uint48, Int56, Uint56:
+	default:
+		return fmt.Errorf("struc: bit-field `%s` must have an integer storage type, not %s", f.Name, f.Type)
+	}
+	switch f.kind {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return fmt.Errorf("struc: bit-field `%s` must be a bool or integer, not %s", f.Name, f.kind)
+	}
+	if f.Slice || f.Ptr {
+		return fmt.Errorf("struc: bit-field `%s` cannot be a slice or pointer", f.Name)
+	}
+	if f.Bits > f.Type.Size()*8 {
+		return fmt.Errorf("struc: bit-field `%s` is %d bits wide but %s only holds %d", f.Name, f.Bits, f.Type, f.Type.Size()*8)
+	}
+	return nil
+}
+
+func (f *Field) isSigned() bool {
+	return f.Type.isSigned()
+}
+
+// bitValue converts v into the raw bits stored for the bit-field f, returning
+// an error if the value does not fit in f.Bits.
+func (f *Field) bitValue(v reflect.Value) (uint64, error) {
+	bits := uint(f.Bits)
+	mask := uint64(1)<<bits - 1
+	var n uint64
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			n = 1
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if f.isSigned() {
+			min, max := -int64(1)<<(bits-1), int64(1)<<(bits-1)-1
+			if i < min || i > max {
+				return 0, fmt.Errorf("struc: value %d overflows %d-bit field %s", i, bits, f.Name)
+			}
+		} else if i < 0 || uint64(i) > mask {
+			return 0, fmt.Errorf("struc: value %d overflows %d-bit field %s", i, bits, f.Name)
+		}
+		n = uint64(i)
+	default:
+		n = v.Uint()
+		if n > mask || (f.isSigned() && n > mask>>1) {
+			return 0, fmt.Errorf("struc: value %d overflows %d-bit field %s", n, bits, f.Name)
+		}
+	}
+	return n & mask, nil
+}
+
+// setBits stores the raw bits n of the bit-field f into v, sign extending
+// them for signed storage types.
+func (f *Field) setBits(v reflect.Value, n uint64) {
+	shift := uint(64 - f.Bits)
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(n != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f.isSigned() {
+			v.SetInt(int64(n<<shift) >> shift)
+		} else {
+			v.SetInt(int64(n))
+		}
+	default:
+		v.SetUint(n)
+	}
+}
+
+func putUint(buf []byte, typ Type, order binary.ByteOrder, n uint64) {
+	switch typ.Size() {
+	case 1:
+		buf[0] = byte(n)
+	case 2:
+		order.PutUint16(buf, uint16(n))
+	case 4:
+		order.PutUint32(buf, uint32(n))
+	case 8:
+		order.PutUint64(buf, n)
+	default:
+		// odd widths are written a byte at a time
+		size := typ.Size()
+		little := isLittleEndian(order)
+		for i := 0; i < size; i++ {
+			if little {
+				buf[i] = byte(n >> uint(8*i))
+			} else {
+				buf[size-1-i] = byte(n >> uint(8*i))
+			}
+		}
+	}
+}
+
+func getUint(buf []byte, typ Type, order binary.ByteOrder) uint64 {
+	switch typ.Size() {
+	case 1:
+		return uint64(buf[0])
+	case 2:
+		return uint64(order.Uint16(buf))
+	case 4:
+		return uint64(order.Uint32(buf))
+	case 8:
+		return order.Uint64(buf)
+	}
+	size := typ.Size()
+	little := isLittleEndian(order)
+	var n uint64
+	for i := 0; i < size; i++ {
+		if little {
+			n |= uint64(buf[i]) << uint(8*i)
+		} else {
+			n |= uint64(buf[size-1-i]) << uint(8*i)
+		}
+	}
+	return n
+}
+
+// packBits packs every bit-field sharing the storage unit that starts at unit.
+// start is the position of the struct in the stream.
+func (f Fields) packBits(buf []byte, val reflect.Value, unit *Field, start int, options *Options) (int, error) {
+	typ := unit.Type.Resolve(options)
+	var n uint64
+	for _, i := range unit.bitGroup {
+		field := f[i]
+		v, err := f.packValue(val, i, start, options)
+		if err != nil {
+			return 0, err
+		}
+		bits, err := field.bitValue(v)
+		if err != nil {
+			return 0, err
+		}
+		n |= bits << uint(field.bitShift)
+	}
+	putUint(buf, typ, unit.order(options), n)
+	return typ.Size(), nil
+}
+
+// unpackBits reads the storage unit that starts at unit and splits it into
+// its bit-fields.
+func (f Fields) unpackBits(r *reader, val reflect.Value, unit *Field, options *Options) error {
+	typ := unit.Type.Resolve(options)
+	buf := r.tmp[:typ.Size()]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	n := getUint(buf, typ, unit.order(options))
+	for _, i := range unit.bitGroup {
+		field := f[i]
+		field.setBits(val.Field(i), (n>>uint(field.bitShift))&(uint64(1)<<uint(field.Bits)-1))
+		if err := field.checkConst(val.Field(i), options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bitHead reports whether the bit-field f starts the bits packed together
+// under options: a storage unit, or under LayoutNatural a run of consecutive
+// bit-fields.
+func (f *Field) bitHead(options *Options) bool {
+	if options.Layout == LayoutNatural {
+		return f.bitRun != nil
+	}
+	return f.bitGroup != nil
+}
+
+// cBitRun places the run of bit-fields starting at head the way a C compiler
+// does, with the run starting pos bytes into the struct. A bit-field follows
+// the one before it if it fits within an aligned unit of its type, and
+// otherwise starts the next unit; in a packed struct it always follows. It
+// returns the bit offset of each field from the start of the run and the
+// size of the run in bytes.
+func (f Fields) cBitRun(head *Field, pos int, options *Options) ([]int, int) {
+	offsets := make([]int, len(head.bitRun))
+	bit := pos * 8
+	for j, i := range head.bitRun {
+		field := f[i]
+		if j > 0 && field.order(options) != f[head.bitRun[j-1]].order(options) {
+			// fields of different byte orders cannot share a byte
+			bit = alignUp(bit, 8)
+		}
+		unit := field.align(options) * 8
+		if field.packAlign != 1 && field.Bits <= unit && bit%unit+field.Bits > unit {
+			bit = alignUp(bit, unit)
+		}
+		offsets[j] = bit - pos*8
+		bit += field.Bits
+	}
+	return offsets, (bit+7)/8 - pos
+}
+
+// cBit returns the byte and mask of bit k of the bit-field f placed at bit
+// offset off. Like C compilers, bits are allocated from the least significant
+// bit of little-endian fields and the most significant bit of big-endian ones.
+func (f *Field) cBit(off, k int, options *Options) (int, byte) {
+	if isLittleEndian(f.order(options)) {
+		off += k
+		return off / 8, 1 << uint(off%8)
+	}
+	off += f.Bits - 1 - k
+	return off / 8, 0x80 >> uint(off%8)
+}
+
+// packCBits packs the run of bit-fields starting at head, which starts pos
+// bytes into the struct, for LayoutNatural. start is the position of the
+// struct in the stream.
+func (f Fields) packCBits(buf []byte, val reflect.Value, head *Field, pos, start int, options *Options) (int, error) {
+	offsets, size := f.cBitRun(head, pos, options)
+	zeroBytes(buf[:size])
+	for j, i := range head.bitRun {
+		field := f[i]
+		v, err := f.packValue(val, i, start, options)
+		if err != nil {
+			return 0, err
+		}
+		bits, err := field.bitValue(v)
+		if err != nil {
+			return 0, err
+		}
+		for k := 0; k < field.Bits; k++ {
+			if bits>>uint(k)&1 != 0 {
+				b, mask := field.cBit(offsets[j], k, options)
+				buf[b] |= mask
+			}
+		}
+	}
+	return size, nil
+}
+
+// unpackCBits reads the run of bit-fields starting at head, which starts pos
+// bytes into the struct, for LayoutNatural.
+func (f Fields) unpackCBits(r *reader, val reflect.Value, head *Field, pos int, options *Options) error {
+	offsets, size := f.cBitRun(head, pos, options)
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	for j, i := range head.bitRun {
+		field := f[i]
+		var n uint64
+		for k := 0; k < field.Bits; k++ {
+			if b, mask := field.cBit(offsets[j], k, options); buf[b]&mask != 0 {
+				n |= 1 << uint(k)
+			}
+		}
+		field.setBits(val.Field(i), n)
+		if err := field.checkConst(val.Field(i), options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
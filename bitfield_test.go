@@ -0,0 +1,131 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type ipv4Head struct {
+	Version  uint8  `struc:"uint8,bits=4"`
+	IHL      uint8  `struc:"uint8,bits=4"`
+	TOS      uint8  `struc:"uint8"`
+	Length   uint16 `struc:"uint16,big"`
+	Id       uint16 `struc:"uint16,big"`
+	Reserved bool   `struc:"uint16,big,bits=1"`
+	DF       bool   `struc:"uint16,big,bits=1"`
+	MF       bool   `struc:"uint16,big,bits=1"`
+	FragOff  uint16 `struc:"uint16,big,bits=13"`
+}
+
+func TestBitfieldMSBFirst(t *testing.T) {
+	ref := &ipv4Head{
+		Version: 4, IHL: 5, TOS: 0, Length: 20, Id: 0x1234,
+		DF: true, FragOff: 0x123,
+	}
+	refBytes := []byte{0x45, 0x00, 0x00, 0x14, 0x12, 0x34, 0x41, 0x23}
+	var buf bytes.Buffer
+	if err := Pack(&buf, ref); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), refBytes) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), refBytes)
+	}
+	out := &ipv4Head{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ref, out) {
+		t.Fatalf("got: %#v\nwant: %#v", out, ref)
+	}
+	if size, err := Sizeof(ref); err != nil || size != len(refBytes) {
+		t.Fatalf("sizeof failed; expected %d, got %d (%v)", len(refBytes), size, err)
+	}
+}
+
+type bitsLSB struct {
+	A    int    `struc:"uint16,little,bits=3,lsbfirst"`
+	B    int    `struc:"uint16,little,bits=6,lsbfirst"`
+	C    int    `struc:"uint16,little,bits=7,lsbfirst"`
+	S    int8   `struc:"int8,bits=4"`
+	Next uint8  `struc:"uint8"`
+	Tail uint32 `struc:"uint32,big,bits=12"`
+}
+
+func TestBitfieldLSBFirst(t *testing.T) {
+	ref := &bitsLSB{A: 5, B: 33, C: 100, S: -3, Next: 7, Tail: 0xabc}
+	// A | B<<3 | C<<9 = 0xc90d
+	refBytes := []byte{0x0d, 0xc9, 0xd0, 7, 0xab, 0xc0, 0, 0}
+	var buf bytes.Buffer
+	if err := Pack(&buf, ref); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), refBytes) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), refBytes)
+	}
+	out := &bitsLSB{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ref, out) {
+		t.Fatalf("got: %#v\nwant: %#v", out, ref)
+	}
+}
+
+type bitsSizeof struct {
+	Flags int    `struc:"uint8,bits=3"`
+	Len   int    `struc:"uint8,bits=5,sizeof=Data"`
+	Data  []byte `struc:"[]byte"`
+	Len2  int    `struc:"uint8,bits=4"`
+	Pad   int    `struc:"uint8,bits=4"`
+	Data2 []byte `struc:"sizefrom=Len2"`
+}
+
+func TestBitfieldSizeof(t *testing.T) {
+	ref := &bitsSizeof{Flags: 2, Data: []byte("abc"), Len2: 2, Data2: []byte("de")}
+	refBytes := []byte{0x43, 'a', 'b', 'c', 0x20, 'd', 'e'}
+	var buf bytes.Buffer
+	if err := Pack(&buf, ref); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), refBytes) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), refBytes)
+	}
+	out := &bitsSizeof{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	ref.Len = 3
+	if !reflect.DeepEqual(ref, out) {
+		t.Fatalf("got: %#v\nwant: %#v", out, ref)
+	}
+}
+
+type bitsOverflow struct {
+	A int `struc:"uint8,bits=3"`
+	B int `struc:"uint8,bits=5"`
+}
+
+func TestBitfieldOverflow(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, &bitsOverflow{A: 8}); err == nil {
+		t.Fatal("failed to error on bit-field overflow")
+	}
+}
+
+type bitsTooWide struct {
+	A int `struc:"uint8,bits=9"`
+}
+
+type bitsBadType struct {
+	A []byte `struc:"[2]byte,bits=3"`
+}
+
+func TestBitfieldParseErrors(t *testing.T) {
+	if err := parseTest(&bitsTooWide{}); err == nil {
+		t.Fatal("failed to error on bit-field wider than its storage unit")
+	}
+	if err := parseTest(&bitsBadType{}); err == nil {
+		t.Fatal("failed to error on slice bit-field")
+	}
+}
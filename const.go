@@ -0,0 +1,135 @@
+package struc
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ConstError is returned by Unpack when a `const=` field does not hold its
+// expected value. The field keeps the value that was found.
+type ConstError struct {
+	Field    string
+	Expected interface{}
+	Found    interface{}
+}
+
+func (e *ConstError) Error() string {
+	return fmt.Sprintf("struc: field %s should be %#v, found %#v", e.Field, e.Expected, e.Found)
+}
+
+// parseConst converts the literal from a `const=` tag into a value of type t.
+// Literals are integers (`const=0x7F454C46`), floats, or quoted Go strings
+// (`const="PK\x03\x04"`) for string and byte slice or array fields.
+func parseConst(lit string, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	if strings.HasPrefix(lit, `"`) {
+		s, err := strconv.Unquote(lit)
+		if err != nil {
+			return v, fmt.Errorf("struc: invalid string in `const=%s`", lit)
+		}
+		switch {
+		case t.Kind() == reflect.String:
+			v.SetString(s)
+		case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+			v.SetBytes([]byte(s))
+		case t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Uint8:
+			if len(s) > t.Len() {
+				return v, fmt.Errorf("struc: `const=%s` does not fit in %s", lit, t)
+			}
+			reflect.Copy(v, reflect.ValueOf([]byte(s)))
+		default:
+			return v, fmt.Errorf("struc: string `const=%s` needs a string or byte field, not %s", lit, t)
+		}
+		return v, nil
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(lit, 0, 64)
+		if err != nil || v.OverflowInt(n) {
+			return v, fmt.Errorf("struc: invalid `const=%s` for %s", lit, t)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(lit, 0, 64)
+		if err != nil || v.OverflowUint(n) {
+			return v, fmt.Errorf("struc: invalid `const=%s` for %s", lit, t)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			return v, fmt.Errorf("struc: invalid `const=%s` for %s", lit, t)
+		}
+		v.SetFloat(n)
+	default:
+		return v, fmt.Errorf("struc: `const=%s` is not supported for %s", lit, t)
+	}
+	return v, nil
+}
+
+// checkConstWidth returns an error if the integer constant of f does not fit
+// its wire type, or its width for bit-fields.
+func (f *Field) checkConstWidth(lit string) error {
+	bits := f.Bits
+	if bits == 0 && !f.Slice {
+		switch f.Type {
+		case Int8, Int16, Int24, Int32, Int40, Int48, Int56,
+			Uint8, Uint16, Uint24, Uint32, Uint40, Uint48, Uint56:
+			bits = f.Type.Size() * 8
+		}
+	}
+	if bits == 0 || bits >= 64 {
+		return nil
+	}
+	ok := true
+	switch v := f.constVal; v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := v.Int()
+		if f.Type.isSigned() {
+			ok = n >= -int64(1)<<uint(bits-1) && n < int64(1)<<uint(bits-1)
+		} else {
+			ok = n >= 0 && n < int64(1)<<uint(bits)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if f.Type.isSigned() {
+			bits--
+		}
+		ok = v.Uint() < uint64(1)<<uint(bits)
+	}
+	if !ok {
+		return fmt.Errorf("struc: `const=%s` overflows %d-bit field `%s`", lit, bits, f.Name)
+	}
+	return nil
+}
+
+// wantConst returns the value Unpack reads back for the constant of f. A
+// constant shorter than a fixed-width string or byte slice field is packed
+// with padding, which Unpack keeps unless the field trims it.
+func (f *Field) wantConst(options *Options) reflect.Value {
+	if !f.Slice || f.Array || f.Len <= 0 || f.Sizefrom != nil || f.constVal.Len() >= f.Len {
+		return f.constVal
+	}
+	buf := make([]byte, f.Len)
+	if _, err := f.Pack(buf, f.constVal, f.Len, options); err != nil {
+		return f.constVal
+	}
+	if f.kind == reflect.String {
+		return reflect.ValueOf(f.unpackString(buf, options))
+	}
+	return reflect.ValueOf(buf)
+}
+
+// checkConst returns a *ConstError if f is a `const=` field and v does not
+// hold its value.
+func (f *Field) checkConst(v reflect.Value, options *Options) error {
+	if !f.constVal.IsValid() {
+		return nil
+	}
+	want := f.wantConst(options).Interface()
+	if reflect.DeepEqual(v.Interface(), want) {
+		return nil
+	}
+	return &ConstError{Field: f.Name, Expected: want, Found: v.Interface()}
+}
@@ -0,0 +1,139 @@
+package struc
+
+import (
+	"bytes"
+	"testing"
+)
+
+type constHeader struct {
+	Magic   uint32  `struc:"uint32,big,const=0x7F454C46"`
+	Sig     string  `struc:"[4]byte,const=\"PK\\x03\\x04\""`
+	Tag     [3]byte `struc:"const=\"a,b\""`
+	Version int8    `struc:"int8,bits=4,const=-2"`
+	Flags   int8    `struc:"int8,bits=4"`
+}
+
+var constBytes = []byte{0x7f, 'E', 'L', 'F', 'P', 'K', 3, 4, 'a', ',', 'b', 0xe5}
+
+func TestConstPack(t *testing.T) {
+	var buf bytes.Buffer
+	// Pack ignores whatever the Go fields hold
+	if err := Pack(&buf, &constHeader{Magic: 1, Sig: "nope", Flags: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), constBytes) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), constBytes)
+	}
+}
+
+func TestConstUnpack(t *testing.T) {
+	out := &constHeader{}
+	if err := Unpack(bytes.NewReader(constBytes), out); err != nil {
+		t.Fatal(err)
+	}
+	want := constHeader{0x7F454C46, "PK\x03\x04", [3]byte{'a', ',', 'b'}, -2, 5}
+	if *out != want {
+		t.Fatalf("got: %#v\nwant: %#v", out, want)
+	}
+}
+
+func TestConstMismatch(t *testing.T) {
+	bad := append([]byte{}, constBytes...)
+	bad[6] = 9
+	err := Unpack(bytes.NewReader(bad), &constHeader{})
+	cerr, ok := err.(*ConstError)
+	if !ok {
+		t.Fatalf("expected *ConstError, got %v", err)
+	}
+	if cerr.Field != "Sig" || cerr.Expected != "PK\x03\x04" || cerr.Found != "PK\x09\x04" {
+		t.Fatalf("unexpected error contents: %#v", cerr)
+	}
+	bad = append([]byte{}, constBytes...)
+	bad[11] = 0x15
+	if _, ok := Unpack(bytes.NewReader(bad), &constHeader{}).(*ConstError); !ok {
+		t.Fatal("failed to error on bad bit-field constant")
+	}
+}
+
+type constString struct {
+	Name string `struc:"const=\"abc\""`
+	Tail string `struc:"const=\"de\""`
+}
+
+func TestConstStringSize(t *testing.T) {
+	in := &constString{Name: "longer than abc"}
+	want := []byte{'a', 'b', 'c', 0, 'd', 'e', 0}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	if size, _ := Sizeof(in); size != len(want) {
+		t.Fatalf("bad size %d, want %d", size, len(want))
+	}
+}
+
+type constOverflow struct {
+	A uint8 `struc:"const=256"`
+}
+
+type constWireOverflow struct {
+	A uint32 `struc:"uint8,const=0x1FF"`
+}
+
+type constBitsOverflow struct {
+	A uint8 `struc:"uint8,bits=3,const=8"`
+	B uint8 `struc:"uint8,bits=5"`
+}
+
+type constBadString struct {
+	A int `struc:"const=\"x\""`
+}
+
+func TestConstParseErrors(t *testing.T) {
+	if err := parseTest(&constOverflow{}); err == nil {
+		t.Fatal("failed to error on overflowing constant")
+	}
+	if err := parseTest(&constWireOverflow{}); err == nil {
+		t.Fatal("failed to error on constant overflowing the wire type")
+	}
+	if err := parseTest(&constBitsOverflow{}); err == nil {
+		t.Fatal("failed to error on constant overflowing the bit-field")
+	}
+	if err := parseTest(&constBadString{}); err == nil {
+		t.Fatal("failed to error on string constant for int field")
+	}
+}
+
+type constPadded struct {
+	Sig   string `struc:"[4]byte,const=\"PK\""`
+	Data  []byte `struc:"[4]byte,pad=0xff,const=\"AB\""`
+	Name  string `struc:"[6]byte,pad=\" \",trim,const=\"ab\""`
+	Count uint32 `struc:"uint16,little,const=0xFFFF"`
+}
+
+func TestConstPadded(t *testing.T) {
+	want := []byte{'P', 'K', 0, 0, 'A', 'B', 0xff, 0xff, 'a', 'b', ' ', ' ', ' ', ' ', 0xff, 0xff}
+	var buf bytes.Buffer
+	if err := Pack(&buf, &constPadded{}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	out := &constPadded{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Sig != "PK\x00\x00" || !bytes.Equal(out.Data, want[4:8]) || out.Name != "ab" || out.Count != 0xFFFF {
+		t.Fatalf("unexpected result: %#v", out)
+	}
+	bad := append([]byte{}, want...)
+	bad[3] = 'Z'
+	cerr, ok := Unpack(bytes.NewReader(bad), &constPadded{}).(*ConstError)
+	if !ok || cerr.Expected != "PK\x00\x00" || cerr.Found != "PK\x00Z" {
+		t.Fatalf("unexpected error: %#v", cerr)
+	}
+}
@@ -3,7 +3,6 @@ package struc
 import (
 	"encoding/binary"
 	"io"
-	"math"
 	"strconv"
 )
 
@@ -14,30 +13,7 @@ func (f *Float16) Pack(p []byte, opt *Options) (int, error) {
 	if order == nil {
 		order = binary.BigEndian
 	}
-	sign := uint16(0)
-	if *f < 0 {
-		sign = 1
-	}
-	var frac, exp uint16
-	if math.IsInf(float64(*f), 0) {
-		exp = 0x1f
-		frac = 0
-	} else if math.IsNaN(float64(*f)) {
-		exp = 0x1f
-		frac = 1
-	} else {
-		bits := math.Float64bits(float64(*f))
-		exp64 := (bits >> 52) & 0x7ff
-		if exp64 != 0 {
-			exp = uint16((exp64 - 1023 + 15) & 0x1f)
-		}
-		frac = uint16((bits >> 42) & 0x3ff)
-	}
-	var out uint16
-	out |= sign << 15
-	out |= exp << 10
-	out |= frac & 0x3ff
-	order.PutUint16(p, out)
+	order.PutUint16(p, uint16(packMinifloat(float64(*f), halfExpBits, halfFracBits)))
 	return 2, nil
 }
 func (f *Float16) Unpack(r io.Reader, length int, opt *Options) error {
@@ -46,28 +22,10 @@ func (f *Float16) Unpack(r io.Reader, length int, opt *Options) error {
 		order = binary.BigEndian
 	}
 	var tmp [2]byte
-	if _, err := r.Read(tmp[:]); err != nil {
+	if _, err := io.ReadFull(r, tmp[:]); err != nil {
 		return err
 	}
-	val := order.Uint16(tmp[:2])
-	sign := (val >> 15) & 1
-	exp := int16((val >> 10) & 0x1f)
-	frac := val & 0x3ff
-	if exp == 0x1f {
-		if frac != 0 {
-			*f = Float16(math.NaN())
-		} else {
-			*f = Float16(math.Inf(int(sign)*-2 + 1))
-		}
-	} else {
-		var bits uint64
-		bits |= uint64(sign) << 63
-		bits |= uint64(frac) << 42
-		if exp > 0 {
-			bits |= uint64(exp-15+1023) << 52
-		}
-		*f = Float16(math.Float64frombits(bits))
-	}
+	*f = Float16(unpackMinifloat(uint64(order.Uint16(tmp[:])), halfExpBits, halfFracBits))
 	return nil
 }
 func (f *Float16) Size(opt *Options) int {
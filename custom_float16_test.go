@@ -21,9 +21,9 @@ func TestFloat16(t *testing.T) {
 		{"0 01111 0000000001", 1.0009765625},
 		{"1 10000 0000000000", -2},
 		{"0 11110 1111111111", 65504},
-		// {"0 00001 0000000000", 0.0000610352},
-		// {"0 00000 1111111111", 0.0000609756},
-		// {"0 00000 0000000001", 0.0000000596046},
+		{"0 00001 0000000000", 0.0000610352},
+		{"0 00000 1111111111", 0.0000609756},
+		{"0 00000 0000000001", 0.0000000596046},
 		{"0 00000 0000000000", 0},
 		// {"1 00000 0000000000", -0},
 		{"0 11111 0000000000", math.Inf(1)},
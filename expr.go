@@ -0,0 +1,429 @@
+package struc
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// expr is a small integer expression used in struct tags, such as
+// `if=Flags&0x04` or `if=Version>=2`. Identifiers refer to fields of the
+// enclosing struct and are resolved when the tag is parsed. Operators and
+// their precedence follow Go.
+type expr struct {
+	src  string
+	root exprNode
+}
+
+type exprNode interface {
+	eval(val reflect.Value) int64
+}
+
+type exprConst int64
+
+type exprField struct {
+	name  string
+	index []int
+}
+
+type exprUnary struct {
+	op string
+	x  exprNode
+}
+
+type exprBinary struct {
+	op   string
+	x, y exprNode
+}
+
+func (e *expr) String() string {
+	return e.src
+}
+
+// eval evaluates the expression against the struct val.
+func (e *expr) eval(val reflect.Value) int64 {
+	return e.root.eval(val)
+}
+
+// fields returns the index of every field referenced by the expression.
+func (e *expr) fields() [][]int {
+	var out [][]int
+	var walk func(n exprNode)
+	walk = func(n exprNode) {
+		switch n := n.(type) {
+		case *exprField:
+			out = append(out, n.index)
+		case *exprUnary:
+			walk(n.x)
+		case *exprBinary:
+			walk(n.x)
+			walk(n.y)
+		}
+	}
+	walk(e.root)
+	return out
+}
+
+func (n exprConst) eval(val reflect.Value) int64 {
+	return int64(n)
+}
+
+func (n *exprField) eval(val reflect.Value) int64 {
+	v := val.FieldByIndex(n.index)
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return 1
+		}
+		return 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	default:
+		return int64(v.Uint())
+	}
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (n *exprUnary) eval(val reflect.Value) int64 {
+	x := n.x.eval(val)
+	switch n.op {
+	case "-":
+		return -x
+	case "!":
+		return boolInt(x == 0)
+	default: // "^"
+		return ^x
+	}
+}
+
+func (n *exprBinary) eval(val reflect.Value) int64 {
+	x := n.x.eval(val)
+	// short circuit logical operators
+	switch n.op {
+	case "&&":
+		return boolInt(x != 0 && n.y.eval(val) != 0)
+	case "||":
+		return boolInt(x != 0 || n.y.eval(val) != 0)
+	}
+	y := n.y.eval(val)
+	switch n.op {
+	case "*":
+		return x * y
+	case "/":
+		// a field holding zero yields zero instead of panicking
+		if y == 0 {
+			return 0
+		}
+		return x / y
+	case "%":
+		if y == 0 {
+			return 0
+		}
+		return x % y
+	case "<<":
+		return x << uint64(y)
+	case ">>":
+		return x >> uint64(y)
+	case "&":
+		return x & y
+	case "&^":
+		return x &^ y
+	case "+":
+		return x + y
+	case "-":
+		return x - y
+	case "|":
+		return x | y
+	case "^":
+		return x ^ y
+	case "==":
+		return boolInt(x == y)
+	case "!=":
+		return boolInt(x != y)
+	case "<":
+		return boolInt(x < y)
+	case "<=":
+		return boolInt(x <= y)
+	case ">":
+		return boolInt(x > y)
+	default: // ">="
+		return boolInt(x >= y)
+	}
+}
+
+var exprPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+	"+": 4, "-": 4, "|": 4, "^": 4,
+	"*": 5, "/": 5, "%": 5, "<<": 5, ">>": 5, "&": 5, "&^": 5,
+}
+
+// longest operators first so the tokenizer is greedy
+var exprOperators = []string{
+	"&&", "||", "==", "!=", "<=", ">=", "<<", ">>", "&^",
+	"<", ">", "+", "-", "*", "/", "%", "&", "|", "^", "!", "(", ")",
+}
+
+func tokenizeExpr(s string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case isIdentByte(c) || c == '.':
+			j := i
+			for j < len(s) && (isIdentByte(s[j]) || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		default:
+			found := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(s[i:], op) {
+					toks = append(toks, op)
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+		}
+	}
+	return toks, nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+type exprParser struct {
+	toks []string
+	pos  int
+	typ  reflect.Type
+	// allow identifiers naming fields of any type, for sizeof expressions
+	anyField bool
+}
+
+// parseExpr parses s, resolving identifiers against the fields of the struct type t.
+func parseExpr(s string, t reflect.Type) (*expr, error) {
+	return (&exprParser{typ: t}).parse(s)
+}
+
+func (p *exprParser) parse(s string) (*expr, error) {
+	toks, err := tokenizeExpr(s)
+	if err != nil {
+		return nil, fmt.Errorf("struc: invalid expression `%s`: %s", s, err)
+	}
+	p.toks = toks
+	root, err := p.binary(1)
+	if err == nil && p.pos < len(p.toks) {
+		err = fmt.Errorf("unexpected `%s`", p.toks[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("struc: invalid expression `%s`: %s", s, err)
+	}
+	return &expr{src: s, root: root}, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) binary(prec int) (exprNode, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		opPrec, ok := exprPrecedence[op]
+		if !ok || opPrec < prec {
+			return x, nil
+		}
+		p.pos++
+		y, err := p.binary(opPrec + 1)
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := y.(exprConst); ok && c == 0 && (op == "/" || op == "%") {
+			return nil, fmt.Errorf("division by zero")
+		}
+		x = &exprBinary{op: op, x: x, y: y}
+	}
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	tok := p.peek()
+	p.pos++
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case tok == "-" || tok == "!" || tok == "^":
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnary{op: tok, x: x}, nil
+	case tok == "(":
+		x, err := p.binary(1)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing `)`")
+		}
+		p.pos++
+		return x, nil
+	case tok[0] >= '0' && tok[0] <= '9':
+		if n, err := strconv.ParseInt(tok, 0, 64); err == nil {
+			return exprConst(n), nil
+		}
+		n, err := strconv.ParseUint(tok, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number `%s`", tok)
+		}
+		return exprConst(n), nil
+	case isIdentByte(tok[0]):
+		return p.field(tok)
+	}
+	return nil, fmt.Errorf("unexpected `%s`", tok)
+}
+
+func (p *exprParser) field(name string) (exprNode, error) {
+	var index []int
+	typ := p.typ
+	for _, part := range strings.Split(name, ".") {
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("field `%s` does not exist", name)
+		}
+		sf, ok := typ.FieldByName(part)
+		if !ok {
+			return nil, fmt.Errorf("field `%s` does not exist", name)
+		}
+		index = append(index, sf.Index...)
+		typ = sf.Type
+	}
+	switch typ.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		if !p.anyField {
+			return nil, fmt.Errorf("field `%s` is not an integer or bool", name)
+		}
+	}
+	return &exprField{name: name, index: index}, nil
+}
+
+// linear reduces the expression to a*x+b, where x is the only field it
+// refers to. ok is false unless the expression is built from x and
+// constants with +, - and *, which guarantees it can be inverted.
+func (e *expr) linear() (a, b int64, x *exprField, ok bool) {
+	var walk func(n exprNode) (a, b int64, ok bool)
+	walk = func(n exprNode) (int64, int64, bool) {
+		switch n := n.(type) {
+		case exprConst:
+			return 0, int64(n), true
+		case *exprField:
+			if x != nil {
+				return 0, 0, false
+			}
+			x = n
+			return 1, 0, true
+		case *exprUnary:
+			a, b, ok := walk(n.x)
+			if ok && n.op == "-" {
+				return -a, -b, true
+			}
+		case *exprBinary:
+			a1, b1, ok1 := walk(n.x)
+			a2, b2, ok2 := walk(n.y)
+			if !ok1 || !ok2 {
+				return 0, 0, false
+			}
+			switch {
+			case n.op == "+":
+				return a1 + a2, b1 + b2, true
+			case n.op == "-":
+				return a1 - a2, b1 - b2, true
+			case n.op == "*" && a1 == 0:
+				return a2 * b1, b2 * b1, true
+			case n.op == "*" && a2 == 0:
+				return a1 * b2, b1 * b2, true
+			}
+		}
+		return 0, 0, false
+	}
+	a, b, ok = walk(e.root)
+	return a, b, x, ok && x != nil && a != 0
+}
+
+// sizeExpr relates the length of a field to the value of the field holding
+// it. For `sizeof=` expressions value = a*length + b, and for `sizefrom=`
+// expressions length = a*value + b.
+type sizeExpr struct {
+	src     string
+	a, b    int64
+	fromLen bool
+}
+
+// parseSizeExpr parses a `sizeof=` (fromLen) or `sizefrom=` expression,
+// returning the field it refers to.
+func parseSizeExpr(s string, t reflect.Type, fromLen bool) (*sizeExpr, *exprField, error) {
+	e, err := (&exprParser{typ: t, anyField: fromLen}).parse(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, b, x, ok := e.linear()
+	if !ok {
+		return nil, nil, fmt.Errorf("struc: size expression `%s` must use a single field with +, - and * so it can be inverted", s)
+	}
+	return &sizeExpr{src: s, a: a, b: b, fromLen: fromLen}, x, nil
+}
+
+func (e *sizeExpr) String() string {
+	return e.src
+}
+
+// length returns the length described by the stored value.
+func (e *sizeExpr) length(value int64) (int, error) {
+	n := e.a*value + e.b
+	if e.fromLen {
+		if (value-e.b)%e.a != 0 {
+			return 0, fmt.Errorf("struc: value %d does not match size expression `%s`", value, e.src)
+		}
+		n = (value - e.b) / e.a
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("struc: value %d gives negative length %d for size expression `%s`", value, n, e.src)
+	}
+	return int(n), nil
+}
+
+// value returns the value stored for length.
+func (e *sizeExpr) value(length int) (int64, error) {
+	if e.fromLen {
+		return e.a*int64(length) + e.b, nil
+	}
+	if (int64(length)-e.b)%e.a != 0 {
+		return 0, fmt.Errorf("struc: length %d cannot be represented by size expression `%s`", length, e.src)
+	}
+	return (int64(length) - e.b) / e.a, nil
+}
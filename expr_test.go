@@ -0,0 +1,178 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type exprVars struct {
+	Flags   uint8
+	Version int
+	On      bool
+	Hdr     struct{ Kind uint16 }
+}
+
+func TestExprEval(t *testing.T) {
+	vars := exprVars{Flags: 0x05, Version: 3, On: true}
+	vars.Hdr.Kind = 7
+	val := reflect.ValueOf(vars)
+	tests := []struct {
+		src  string
+		want int64
+	}{
+		{"Flags&0x04", 4},
+		{"Flags&0x02", 0},
+		{"Version>=2", 1},
+		{"Version>=2 && Flags&1 == 1", 1},
+		{"Version<2 || !On", 0},
+		{"(Version+1)*4-20", -4},
+		{"-Version + 10 % 4", -1},
+		{"1<<Version | 1", 9},
+		{"^0", -1},
+		{"Hdr.Kind == 7", 1},
+	}
+	for _, test := range tests {
+		e, err := parseExpr(test.src, val.Type())
+		if err != nil {
+			t.Errorf("%s: %s", test.src, err)
+			continue
+		}
+		if got := e.eval(val); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.src, got, test.want)
+		}
+	}
+}
+
+func TestExprParseErrors(t *testing.T) {
+	typ := reflect.TypeOf(exprVars{})
+	for _, src := range []string{"", "Missing", "Flags &", "(Flags", "Flags)", "Flags / 0", "Hdr", "Flags @ 1"} {
+		if _, err := parseExpr(src, typ); err == nil {
+			t.Errorf("failed to error on bad expression `%s`", src)
+		}
+	}
+}
+
+type condStruct struct {
+	Flags   uint8
+	Version uint8
+	Opt     uint32 `struc:"uint32,big,if=Flags&0x04"`
+	Extra   uint16 `struc:"uint16,big,if=Version>=2"`
+	Tail    uint8
+}
+
+func TestConditionalFields(t *testing.T) {
+	tests := []struct {
+		in    condStruct
+		bytes []byte
+	}{
+		{condStruct{0, 1, 0, 0, 9}, []byte{0, 1, 9}},
+		{condStruct{4, 1, 0x01020304, 0, 9}, []byte{4, 1, 1, 2, 3, 4, 9}},
+		{condStruct{0, 2, 0, 0x0506, 9}, []byte{0, 2, 5, 6, 9}},
+		{condStruct{4, 3, 0x01020304, 0x0506, 9}, []byte{4, 3, 1, 2, 3, 4, 5, 6, 9}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := Pack(&buf, &test.in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), test.bytes) {
+			t.Errorf("got: %#v\nwant: %#v", buf.Bytes(), test.bytes)
+		}
+		if size, _ := Sizeof(&test.in); size != len(test.bytes) {
+			t.Errorf("sizeof failed; expected %d, got %d", len(test.bytes), size)
+		}
+		// unpack into a dirty struct to make sure skipped fields are zeroed
+		out := condStruct{Opt: 0xff, Extra: 0xff}
+		if err := Unpack(&buf, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out != test.in {
+			t.Errorf("got: %#v\nwant: %#v", out, test.in)
+		}
+	}
+}
+
+type condForward struct {
+	Opt   uint32 `struc:"if=Flags"`
+	Flags uint8
+}
+
+func TestConditionalForwardReference(t *testing.T) {
+	if err := parseTest(&condForward{}); err == nil {
+		t.Fatal("failed to error on condition referring to a later field")
+	}
+}
+
+type ipv4Options struct {
+	VersionIHL uint8  `struc:"uint8,bits=4"`
+	IHL        uint8  `struc:"uint8,bits=4"`
+	Options    []byte `struc:"sizefrom=(IHL*4)-20"`
+}
+
+type minusOne struct {
+	Len  uint8 `struc:"sizeof=Data-1"`
+	Data []byte
+}
+
+func TestSizeExpr(t *testing.T) {
+	in := &ipv4Options{VersionIHL: 4, Options: []byte{1, 2, 3, 4, 5, 6, 7, 8}}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x47, 1, 2, 3, 4, 5, 6, 7, 8}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	out := &ipv4Options{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.IHL != 7 || !bytes.Equal(out.Options, in.Options) {
+		t.Fatalf("bad unpack: %#v", out)
+	}
+
+	buf.Reset()
+	if err := Pack(&buf, &minusOne{Data: []byte("abc")}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{2, 'a', 'b', 'c'}) {
+		t.Fatalf("bad minus one encoding: %#v", buf.Bytes())
+	}
+	m := &minusOne{}
+	if err := Unpack(bytes.NewReader(buf.Bytes()), m); err != nil {
+		t.Fatal(err)
+	}
+	if string(m.Data) != "abc" || m.Len != 2 {
+		t.Fatalf("bad unpack: %#v", m)
+	}
+}
+
+func TestSizeExprErrors(t *testing.T) {
+	// 6 bytes is not a whole number of words
+	if err := Pack(&bytes.Buffer{}, &ipv4Options{Options: make([]byte, 6)}); err == nil {
+		t.Fatal("failed to error on unrepresentable length")
+	}
+	// IHL below 5 gives a negative length
+	if err := Unpack(bytes.NewReader([]byte{0x41}), &ipv4Options{}); err == nil {
+		t.Fatal("failed to error on negative length")
+	}
+	type square struct {
+		Len  int
+		Data []byte `struc:"sizefrom=Len*Len"`
+	}
+	type halved struct {
+		Len  int
+		Data []byte `struc:"sizefrom=Len/2"`
+	}
+	type two struct {
+		A, B int
+		Data []byte `struc:"sizefrom=A+B"`
+	}
+	for _, v := range []interface{}{&square{}, &halved{}, &two{}} {
+		if err := Pack(&bytes.Buffer{}, v); err == nil {
+			t.Errorf("%T: failed to reject non-invertible size expression", v)
+		}
+	}
+}
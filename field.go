@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"time"
 )
 
 type Field struct {
@@ -24,11 +25,60 @@ type Field struct {
 	kind       reflect.Kind
 	Bitmap     BitmapperType
 	NullString bool
+	Bits       int
+	bitShift   int
+	lsbFirst   bool
+	bitGroup   []int
+	bitRun     []int
+	cond       *expr
+	union      reflect.Type
+	unionFrom  []int
+	unionOf    []int
+	offsetFrom []int
+	offsetOf   []int
+	base       string
+	packAlign  int
+	constVal   reflect.Value
+	sizeExpr   *sizeExpr
+	byteSize   bool
+	totalSize  bool
+	span       []int
+	spanOf     []int
+	spanMark   bool
+	rest       bool
+	until      *terminator
+	padByte    byte
+	hasPad     bool
+	cstring    bool
+	trim       bool
+	strict     bool
+	prefix     Type
+	alignTo    int
+	alignStart bool
+	byteOrders []orderCase
+	since      int
+	before     int
+	isVersion  bool
+	round      string
+	loc        *time.Location
+	// set on struct fields holding fields aligned to the stream start
+	streamAlign bool
+	// set on fields that use none of the features needing the general
+	// Pack, Unpack and Sizeof paths
+	plain bool
 }
 
+// positions that offsetfrom= fields are relative to
+const (
+	baseStart  = "start"
+	baseStruct = "struct"
+)
+
 func (f *Field) String() string {
 	var out string
-	if f.Type == Pad {
+	if f.Type == Pad && f.hasPad {
+		return fmt.Sprintf("{type: Pad, len: %d, pad: %#02x}", f.Len, f.padByte)
+	} else if f.Type == Pad {
 		return fmt.Sprintf("{type: Pad, len: %d}", f.Len)
 	} else {
 		out = fmt.Sprintf("type: %s, order: %v", f.Type.String(), f.Order)
@@ -41,20 +91,199 @@ func (f *Field) String() string {
 	if f.Sizeof != nil {
 		out += fmt.Sprintf(", sizeof: %v", f.Sizeof)
 	}
+	if f.sizeExpr != nil {
+		out += fmt.Sprintf(", size: %s", f.sizeExpr)
+	}
+	if f.byteSize {
+		out += ", bytesize"
+	}
+	if f.rest {
+		out += ", rest"
+	}
+	if f.until != nil {
+		out += fmt.Sprintf(", until: %s", f.until)
+	}
+	if f.hasPad {
+		out += fmt.Sprintf(", pad: %#02x", f.padByte)
+	}
+	if f.cstring {
+		out += ", cstring"
+	}
+	if f.trim {
+		out += ", trim"
+	}
+	if f.strict {
+		out += ", strict"
+	}
+	if f.prefix != Invalid {
+		out += fmt.Sprintf(", pstring: %s", f.prefix)
+	}
+	if f.loc != nil {
+		out += fmt.Sprintf(", tz: %s", f.loc)
+	}
+	if f.round != "" {
+		out += fmt.Sprintf(", round: %s", f.round)
+	}
+	if f.isVersion {
+		out += ", version"
+	}
+	if f.since > 0 {
+		out += fmt.Sprintf(", since: %d", f.since)
+	}
+	if f.before > 0 {
+		out += fmt.Sprintf(", before: %d", f.before)
+	}
+	if len(f.byteOrders) > 0 {
+		out += fmt.Sprintf(", byteorder: %d cases", len(f.byteOrders))
+	}
+	if f.alignTo > 0 && f.alignStart {
+		out += fmt.Sprintf(", align: %d, base: %s", f.alignTo, baseStart)
+	} else if f.alignTo > 0 {
+		out += fmt.Sprintf(", align: %d", f.alignTo)
+	}
+	if f.totalSize {
+		out += ", totalsize"
+	} else if f.span != nil {
+		out += fmt.Sprintf(", sizeof: %d..%d", f.span[0], f.span[1])
+	}
+	if f.Bits > 0 {
+		out += fmt.Sprintf(", bits: %d", f.Bits)
+	}
+	if f.cond != nil {
+		out += fmt.Sprintf(", if: %s", f.cond)
+	}
+	if f.unionFrom != nil {
+		out += fmt.Sprintf(", union: %v", f.unionFrom)
+	}
+	if f.offsetFrom != nil {
+		out += fmt.Sprintf(", offsetfrom: %v, base: %s", f.offsetFrom, f.base)
+	}
+	if f.constVal.IsValid() {
+		out += fmt.Sprintf(", const: %#v", f.constVal.Interface())
+	}
 	if len(f.Bitmap) != 0 {
 		out += fmt.Sprintf(", bitmap: %+v", f.Bitmap)
 	}
 	return "{" + out + "}"
 }
 
+// order returns the byte order used for f, preferring Options.Order when set.
+func (f *Field) order(options *Options) binary.ByteOrder {
+	if options.Order != nil {
+		return options.Order
+	}
+	return f.Order
+}
+
+// present reports whether f is encoded for the struct val, evaluating its
+// `if=` condition against the other fields of val and its `since=` and
+// `before=` version gates.
+func (f *Field) present(val reflect.Value, options *Options) bool {
+	return (f.cond == nil || f.cond.eval(val) != 0) && f.inVersion(options)
+}
+
+// pad returns the byte filling pad fields and the unused end of fixed-width
+// strings and byte slices.
+func (f *Field) pad(options *Options) byte {
+	if f.hasPad {
+		return f.padByte
+	}
+	return options.PadByte
+}
+
+// checkPad verifies that the pad field read into buf holds its pad byte, when
+// Options.CheckPad is set.
+func (f *Field) checkPad(buf []byte, options *Options) error {
+	if !options.CheckPad {
+		return nil
+	}
+	pad := f.pad(options)
+	for i, b := range buf {
+		if b != pad {
+			return fmt.Errorf("struc: pad field %s holds %#02x at byte %d, expected %#02x", f.Name, b, i, pad)
+		}
+	}
+	return nil
+}
+
+// checkFill verifies that the unused end of the fixed-width string or byte
+// slice read into buf holds its pad byte, when Options.CheckPad is set. The
+// unused end follows the NUL of a `cstring` field, and is the run of trailing
+// bytes a `trim` field drops. Other fields may hold pad bytes as data, so
+// only their trailing pad bytes are taken as unused, and there is nothing to
+// check.
+func (f *Field) checkFill(buf []byte, options *Options) error {
+	if !options.CheckPad || !f.Slice || f.Sizefrom != nil || f.Len <= 0 {
+		return nil
+	}
+	pad := f.pad(options)
+	start := len(buf)
+	if f.cstring {
+		if i := bytes.IndexByte(buf, 0); i >= 0 {
+			start = i + 1
+		}
+	} else if f.trim {
+		for start > 0 {
+			if b := buf[start-1]; b != 0 && b != ' ' && b != pad {
+				break
+			}
+			start--
+		}
+	}
+	for i := start; i < len(buf); i++ {
+		if buf[i] != pad {
+			return fmt.Errorf("struc: field %s holds %#02x at byte %d of its padding, expected %#02x", f.Name, buf[i], i, pad)
+		}
+	}
+	return nil
+}
+
+// checkString returns an error if a string of n bytes does not fit the width
+// of a `strict` or `cstring` field. A `cstring` also needs room for its NUL.
+func (f *Field) checkString(n, width int) error {
+	if f.cstring && n >= width {
+		return fmt.Errorf("struc: string field %s holds %d bytes, leaving no room for a NUL in %d", f.Name, n, width)
+	} else if f.strict && n > width {
+		return fmt.Errorf("struc: string field %s holds %d bytes, more than its width of %d", f.Name, n, width)
+	}
+	return nil
+}
+
+// unpackString converts buf to a string, stopping at the first NUL for
+// `cstring` fields and dropping trailing NULs, spaces and pad bytes for
+// `trim` fields.
+func (f *Field) unpackString(buf []byte, options *Options) string {
+	if f.cstring {
+		if i := bytes.IndexByte(buf, 0); i >= 0 {
+			buf = buf[:i]
+		}
+	}
+	if f.trim {
+		pad := f.pad(options)
+		for len(buf) > 0 {
+			if b := buf[len(buf)-1]; b != 0 && b != ' ' && b != pad {
+				break
+			}
+			buf = buf[:len(buf)-1]
+		}
+	}
+	return string(buf)
+}
+
 func (f *Field) IsString() bool {
 	return (f.kind == reflect.String) && (f.Type == String)
 }
 
 func (f *Field) Size(val reflect.Value, options *Options, sliceLength int) int {
 	typ := f.Type.Resolve(options)
+	if f.constVal.IsValid() {
+		// Pack writes the constant, whatever the field holds
+		val = f.constVal
+	}
 	size := 0
-	if f.Bitmap != nil {
+	if f.prefix != Invalid {
+		size = f.prefix.Size() + val.Len()
+	} else if f.Bitmap != nil {
 		size = f.Len * typ.Size()
 	} else if typ == Struct || (f.Slice && f.IsString()) {
 		vals := []reflect.Value{val}
@@ -64,16 +293,35 @@ func (f *Field) Size(val reflect.Value, options *Options, sliceLength int) int {
 				vals[i] = val.Index(i)
 			}
 		}
+		opts := options
 		for _, val := range vals {
+			if f.streamAlign {
+				// each element starts where the last one ended
+				o := *options
+				o.streamPos = options.streamPos + size
+				opts = &o
+			}
 			// Always include the null byte for string slices
 			if f.IsString() {
 				size += val.Len() + 1
 			} else {
-				size += f.Fields.Sizeof(val, options)
+				size += f.Fields.Sizeof(val, opts)
 			}
 		}
 	} else if typ == Pad {
 		size = f.Len
+	} else if typ.isVarint() {
+		length := 0
+		if f.Slice {
+			length = val.Len()
+			if f.Len > 1 {
+				length = f.Len
+			}
+			if sliceLength > 0 {
+				length = sliceLength
+			}
+		}
+		size = f.varintSize(val, length)
 	} else if f.Slice || f.IsString() {
 		length := val.Len()
 		if f.Len > 1 {
@@ -82,7 +330,7 @@ func (f *Field) Size(val reflect.Value, options *Options, sliceLength int) int {
 		// Grab the size in the from field if one was specified
 		if sliceLength > 0 {
 			length = sliceLength
-		} else if f.IsString() {
+		} else if f.IsString() && !f.rest {
 			// Otherwise, use the full length and Null terminate strings
 			length += 1
 			f.NullString = true
@@ -90,6 +338,12 @@ func (f *Field) Size(val reflect.Value, options *Options, sliceLength int) int {
 		size = length * typ.Size()
 	} else if typ == CustomType {
 		return val.Addr().Interface().(Custom).Size(options)
+	} else if typ == Union {
+		elem, fields, err := f.unionElem(val)
+		if err != nil {
+			return 0
+		}
+		size = fields.Sizeof(elem, options)
 	} else {
 		size = typ.Size()
 	}
@@ -112,7 +366,10 @@ func (f *Field) packVal(buf []byte, val reflect.Value, length int, options *Opti
 	switch typ {
 	case Struct:
 		return f.Fields.Pack(buf, val, options)
-	case Bool, Int8, Int16, Int32, Int64, Uint8, Uint16, Uint32, Uint64:
+	case Uvarint, Varint, Sleb128:
+		return f.packVarint(buf, val)
+	case Bool, Int8, Int16, Int32, Int64, Uint8, Uint16, Uint32, Uint64,
+		Int24, Uint24, Int40, Uint40, Int48, Uint48, Int56, Uint56:
 		size = typ.Size()
 		var n uint64
 		switch f.kind {
@@ -142,11 +399,20 @@ func (f *Field) packVal(buf []byte, val reflect.Value, length int, options *Opti
 			order.PutUint32(buf, uint32(n))
 		case Int64, Uint64:
 			order.PutUint64(buf, uint64(n))
+		default:
+			if err := f.checkWidth(val, typ); err != nil {
+				return 0, err
+			}
+			putUint(buf, typ, order, n)
 		}
-	case Float32, Float64:
+	case Binary16, BFloat16, Float32, Float64:
 		size = typ.Size()
 		n := val.Float()
 		switch typ {
+		case Binary16:
+			order.PutUint16(buf, uint16(packMinifloat(n, halfExpBits, halfFracBits)))
+		case BFloat16:
+			order.PutUint16(buf, uint16(packMinifloat(n, bf16ExpBits, bf16FracBits)))
 		case Float32:
 			order.PutUint32(buf, math.Float32bits(float32(n)))
 		case Float64:
@@ -167,17 +433,34 @@ func (f *Field) packVal(buf []byte, val reflect.Value, length int, options *Opti
 		}
 	case CustomType:
 		return val.Addr().Interface().(Custom).Pack(buf, options)
+	case Union:
+		elem, fields, err := f.unionElem(val)
+		if err != nil {
+			return 0, err
+		}
+		return fields.Pack(buf, elem, options)
 	default:
+		if typ.isFixed() {
+			return f.packFixed(buf, val, typ, order)
+		} else if typ.isBCD() {
+			return f.packBCD(buf, val, typ)
+		} else if typ.isTime() {
+			return f.packTime(buf, val, typ, order, options)
+		}
 		panic(fmt.Sprintf("no pack handler for type: %s", typ))
 	}
 	return
 }
 
 func (f *Field) Pack(buf []byte, val reflect.Value, length int, options *Options) (int, error) {
+	if f.prefix != Invalid {
+		return f.packPrefixed(buf, val, options)
+	}
 	typ := f.Type.Resolve(options)
 	if typ == Pad {
+		pad := f.pad(options)
 		for i := 0; i < length; i++ {
-			buf[i] = 0
+			buf[i] = pad
 		}
 		return length, nil
 	}
@@ -190,15 +473,20 @@ func (f *Field) Pack(buf []byte, val reflect.Value, length int, options *Options
 			var tmp []byte
 			if f.kind == reflect.String {
 				tmp = []byte(val.String())
+				if err := f.checkString(len(tmp), length); err != nil {
+					return 0, err
+				}
 			} else {
 				tmp = val.Bytes()
 			}
 			// If the requested length is longer than the value, then we need to pad the buffer
 			if end < length {
 				copy(buf, tmp[:end])
-				// TODO: allow configuring pad byte?
-				rep := bytes.Repeat([]byte{0}, length-end)
+				rep := bytes.Repeat([]byte{f.pad(options)}, length-end)
 				copy(buf[end:], rep)
+				if f.cstring {
+					buf[end] = 0
+				}
 				return length, nil
 			} else {
 				// Else, just copy the length requested
@@ -238,9 +526,13 @@ func (f *Field) unpackVal(buf []byte, val reflect.Value, length int, options *Op
 	}
 	typ := f.Type.Resolve(options)
 	switch typ {
-	case Float32, Float64:
+	case Binary16, BFloat16, Float32, Float64:
 		var n float64
 		switch typ {
+		case Binary16:
+			n = unpackMinifloat(uint64(order.Uint16(buf)), halfExpBits, halfFracBits)
+		case BFloat16:
+			n = unpackMinifloat(uint64(order.Uint16(buf)), bf16ExpBits, bf16FracBits)
 		case Float32:
 			n = float64(math.Float32frombits(order.Uint32(buf)))
 		case Float64:
@@ -252,7 +544,8 @@ func (f *Field) unpackVal(buf []byte, val reflect.Value, length int, options *Op
 		default:
 			return fmt.Errorf("struc: refusing to unpack float into field %s of type %s", f.Name, f.kind.String())
 		}
-	case Bool, Int8, Int16, Int32, Int64, Uint8, Uint16, Uint32, Uint64:
+	case Bool, Int8, Int16, Int32, Int64, Uint8, Uint16, Uint32, Uint64,
+		Int24, Uint24, Int40, Uint40, Int48, Uint48, Int56, Uint56:
 		var n uint64
 		switch typ {
 		case Int8:
@@ -271,6 +564,13 @@ func (f *Field) unpackVal(buf []byte, val reflect.Value, length int, options *Op
 			n = uint64(order.Uint32(buf))
 		case Uint64:
 			n = uint64(order.Uint64(buf))
+		default:
+			n = getUint(buf, typ, order)
+			if typ.isSigned() {
+				// sign extend from the top bit of the field
+				shift := uint(64 - typ.Size()*8)
+				n = uint64(int64(n<<shift) >> shift)
+			}
 		}
 		switch f.kind {
 		case reflect.Bool:
@@ -281,6 +581,14 @@ func (f *Field) unpackVal(buf []byte, val reflect.Value, length int, options *Op
 			val.SetUint(n)
 		}
 	default:
+		if typ.isFixed() {
+			f.unpackFixed(buf, val, typ, order)
+			return nil
+		} else if typ.isBCD() {
+			return f.unpackBCD(buf, val, typ)
+		} else if typ.isTime() {
+			return f.unpackTime(buf, val, typ, order, options)
+		}
 		panic(fmt.Sprintf("no unpack handler for type: %s", typ))
 	}
 	return nil
@@ -288,13 +596,14 @@ func (f *Field) unpackVal(buf []byte, val reflect.Value, length int, options *Op
 
 func (f *Field) Unpack(buf []byte, val reflect.Value, length int, options *Options) error {
 	typ := f.Type.Resolve(options)
-	if typ == Pad || (f.IsString() && !f.Slice) || (f.kind == reflect.String && !f.IsString()) {
+	if typ == Pad || (f.IsString() && !f.Slice) || (f.kind == reflect.String && !f.IsString() && !typ.isBCD()) {
 		if typ == Pad {
-			return nil
-		} else {
-			val.SetString(string(buf))
-			return nil
+			return f.checkPad(buf, options)
+		} else if err := f.checkFill(buf, options); err != nil {
+			return err
 		}
+		val.SetString(f.unpackString(buf, options))
+		return nil
 	} else if f.Bitmap != nil {
 		return bitmapUnpack(buf, val, length, options, f)
 	} else if f.Slice {
@@ -306,7 +615,7 @@ func (f *Field) Unpack(buf []byte, val reflect.Value, length int, options *Optio
 		// special case byte slices for performance
 		if !f.Array && typ == Uint8 && f.defType == Uint8 {
 			copy(val.Bytes(), buf[:length])
-			return nil
+			return f.checkFill(buf[:length], options)
 		}
 		pos := 0
 		size := typ.Size()
@@ -2,6 +2,7 @@ package struc
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
 )
 
@@ -75,3 +76,118 @@ func TestSliceCap(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+type padByteStruct struct {
+	Name  string `struc:"[6]byte,pad=\" \",trim"`
+	Gap   []byte `struc:"[2]pad,pad=0xFF"`
+	Data  []byte `struc:"[3]byte"`
+	Spare []byte `struc:"[2]pad"`
+}
+
+func TestPadByte(t *testing.T) {
+	var buf bytes.Buffer
+	in := &padByteStruct{Name: "abc", Data: []byte{1}}
+	if err := PackWithOptions(&buf, in, &Options{PadByte: 0xEE}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{'a', 'b', 'c', ' ', ' ', ' ', 0xff, 0xff, 1, 0xee, 0xee, 0xee, 0xee}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	out := &padByteStruct{}
+	if err := UnpackWithOptions(bytes.NewReader(want), out, &Options{PadByte: 0xEE, CheckPad: true}); err != nil {
+		t.Fatal(err)
+	}
+	// padding is only checked when asked for
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnpackWithOptions(bytes.NewReader(want), out, &Options{CheckPad: true}); err == nil {
+		t.Fatal("failed to verify pad bytes")
+	}
+	// the bytes trimmed from Name are checked too
+	bad := append([]byte{}, want...)
+	bad[4] = 0
+	if err := UnpackWithOptions(bytes.NewReader(bad), out, &Options{PadByte: 0xEE, CheckPad: true}); err == nil {
+		t.Fatal("failed to verify the fill of a trim field")
+	}
+	type badPad struct {
+		A int `struc:"pad=0x100"`
+	}
+	if err := Pack(&buf, &badPad{}); err == nil {
+		t.Fatal("failed to reject bad pad= tag")
+	}
+}
+
+type padData struct {
+	City string `struc:"[12]byte,pad=\" \",trim"`
+	Data []byte `struc:"[4]byte,pad=0xFF"`
+}
+
+func TestPadByteData(t *testing.T) {
+	// pad bytes within the data are not mistaken for the unused end
+	in := &padData{City: "NEW YORK", Data: []byte{0xff, 1, 0xff}}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	out := &padData{}
+	if err := UnpackWithOptions(&buf, out, &Options{CheckPad: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := &padData{City: "NEW YORK", Data: []byte{0xff, 1, 0xff, 0xff}}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("got: %#v\nwant: %#v", out, want)
+	}
+}
+
+type stringModes struct {
+	C      string `struc:"[6]byte,cstring,pad=0xFF"`
+	Trim   string `struc:"[6]byte,trim,pad=\" \""`
+	Strict string `struc:"[3]byte,strict"`
+	Raw    string `struc:"[3]byte"`
+}
+
+func TestStringModes(t *testing.T) {
+	var buf bytes.Buffer
+	in := &stringModes{C: "ab", Trim: "cd", Strict: "efg", Raw: "h"}
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("ab\x00\xff\xff\xffcd    efgh\x00\x00")
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	data := []byte("ab\x00zz\x00cd \x00  efgh\x00\x00")
+	out := &stringModes{}
+	if err := Unpack(bytes.NewReader(data), out); err != nil {
+		t.Fatal(err)
+	}
+	want2 := stringModes{C: "ab", Trim: "cd", Strict: "efg", Raw: "h\x00\x00"}
+	if *out != want2 {
+		t.Fatalf("got: %#v\nwant: %#v", out, want2)
+	}
+	// a cstring is padded after its NUL
+	if err := UnpackWithOptions(bytes.NewReader(want), out, &Options{CheckPad: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnpackWithOptions(bytes.NewReader(data), out, &Options{CheckPad: true}); err == nil {
+		t.Fatal("failed to verify the fill after a cstring")
+	}
+	for _, bad := range []*stringModes{{C: "abcdef"}, {Strict: "efgh"}} {
+		if err := Pack(&buf, bad); err == nil {
+			t.Errorf("failed to reject overlong string: %#v", bad)
+		}
+	}
+	// other fields still truncate
+	buf.Reset()
+	if err := Pack(&buf, &stringModes{Raw: "hijk"}); err != nil {
+		t.Fatal(err)
+	}
+	type notString struct {
+		A []byte `struc:"[4]byte,cstring"`
+	}
+	if err := Pack(&buf, &notString{}); err == nil {
+		t.Fatal("failed to reject cstring on a byte slice")
+	}
+}
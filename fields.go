@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"reflect"
 	"strings"
 )
@@ -33,20 +34,113 @@ func (f Fields) Sizeof(val reflect.Value, options *Options) int {
 	for val.Kind() == reflect.Ptr {
 		val = val.Elem()
 	}
-	size := 0
-	for i, field := range f {
-		if field != nil {
-			var sliceLength int
-			// Grab the size in the from field if one was specified
-			if field.Sizefrom != nil {
-				if n, ok := SizeFromField(val.FieldByIndex(field.Sizefrom)); ok {
-					sliceLength = n
+	return f.sizeofUntil(val, -1, options.streamPos, options)
+}
+
+// sizeofUntil returns the encoded size of val or, when stop >= 0, the
+// position of field stop relative to the start of the struct. Fields are
+// laid out the way Pack writes them: the fixed part of the struct first,
+// then offset fields in declaration order. start is the position of the
+// struct in the stream.
+func (f Fields) sizeofUntil(val reflect.Value, stop, start int, options *Options) int {
+	pos := 0
+	for _, offsets := range []bool{false, true} {
+		for i, field := range f {
+			if field == nil || (field.offsetFrom != nil) != offsets {
+				continue
+			}
+			if field.plain && options.Layout == LayoutDefault {
+				if i == stop {
+					return pos
 				}
+				pos += f.plainSize(val, i, options)
+				continue
+			}
+			pos += f.padding(val, i, pos, start, options)
+			if i == stop {
+				return pos
 			}
-			size += field.Size(val.Field(i), options, sliceLength)
+			pos += f.fieldSize(val, i, pos, start, options)
+			if field.isVersion {
+				options = field.setVersion(val.Field(i), options)
+			}
+		}
+	}
+	return pos + f.trailing(pos, options)
+}
+
+// isPlain reports whether f uses none of the layout, condition, offset or
+// length features, so it can be sized, packed and unpacked directly.
+func (f *Field) isPlain() bool {
+	return f.Bits == 0 && f.cond == nil && f.unionOf == nil &&
+		f.offsetFrom == nil && f.offsetOf == nil && !f.constVal.IsValid() &&
+		f.sizeExpr == nil && !f.byteSize && !f.totalSize && f.span == nil &&
+		f.spanOf == nil && !f.spanMark && !f.rest && f.until == nil &&
+		f.prefix == Invalid && f.alignTo == 0 && f.byteOrders == nil &&
+		f.since == 0 && f.before == 0 && !f.isVersion && !f.streamAlign &&
+		!f.Type.isVarint()
+}
+
+// plainSize returns the encoded size of the plain field i of val.
+func (f Fields) plainSize(val reflect.Value, i int, options *Options) int {
+	field := f[i]
+	var sliceLength int
+	if field.Sizefrom != nil {
+		if n, ok := SizeFromField(val.FieldByIndex(field.Sizefrom)); ok {
+			sliceLength = n
+		}
+	}
+	return field.Size(val.Field(i), options, sliceLength)
+}
+
+// fieldSize returns the encoded size of field i of val, which starts pos
+// bytes into the struct. start is the position of the struct in the stream.
+func (f Fields) fieldSize(val reflect.Value, i, pos, start int, options *Options) int {
+	field := f[i]
+	at := start + pos
+	if field.streamAlign && options.streamPos != at {
+		// nested fields are aligned to the stream, so need their position
+		opts := *options
+		opts.streamPos = at
+		options = &opts
+	}
+	if field.Bits > 0 {
+		// a storage unit is counted once, on its first bit-field
+		if !field.bitHead(options) {
+			return 0
+		} else if options.Layout == LayoutNatural {
+			_, size := f.cBitRun(field, pos, options)
+			return size
+		}
+		return field.Type.Resolve(options).Size()
+	}
+	if !field.present(val, options) {
+		return 0
+	}
+	if field.Sizefrom != nil && field.byteSize {
+		return f.byteSize(val, i, options)
+	}
+	if field.until != nil {
+		v := val.Field(i)
+		return field.Size(v, options, 0) + field.termSize(v, options)
+	}
+	if field.Type.isVarint() && !field.Slice {
+		// the size depends on the value Pack writes, such as a length
+		if v, err := f.packValue(val, i, 0, options); err == nil {
+			return field.Size(v, options, 0)
+		}
+	}
+	var sliceLength int
+	// Grab the size in the from field if one was specified
+	if field.Sizefrom != nil && field.sizeExpr != nil {
+		// the length field is rewritten from the data on Pack
+		sliceLength = val.Field(i).Len()
+	} else if field.Sizefrom != nil {
+		if n, ok := SizeFromField(val.FieldByIndex(field.Sizefrom)); ok {
+			sliceLength = n
 		}
 	}
-	return size
+	return field.Size(val.Field(i), options, sliceLength)
 }
 
 func SizeFromField(field reflect.Value) (int, bool) {
@@ -75,148 +169,587 @@ func (f Fields) sizefrom(val reflect.Value, index []int) int {
 	panic(fmt.Sprintf("sizeof field %T.%s not an integer type", val.Interface(), name))
 }
 
+// spanSize returns the encoded size of the fields covered by the `totalsize`
+// or `sizeof=A..B` field. start is the position of the struct in the stream.
+func (f Fields) spanSize(val reflect.Value, field *Field, start int, options *Options) int {
+	if field.totalSize {
+		return f.sizeofUntil(val, -1, start, options)
+	}
+	first, last := field.span[0], field.span[1]
+	end := f.sizeofUntil(val, last, start, options)
+	end += f.fieldSize(val, last, end, start, options)
+	return end - f.sizeofUntil(val, first, start, options)
+}
+
+// byteSize returns the encoded size in bytes of the slice or string field i of
+// val, for `bytesizeof=` fields.
+func (f Fields) byteSize(val reflect.Value, i int, options *Options) int {
+	field := f[i]
+	v := val.Field(i)
+	if field.Type == Struct || (field.Slice && field.IsString()) || field.Type.isVarint() {
+		return field.Size(v, options, 0)
+	}
+	return v.Len() * field.Type.Resolve(options).Size()
+}
+
+// lengthFrom returns the length of field held in its sizefrom field, applying
+// the size expression if there is one.
+func (f Fields) lengthFrom(val reflect.Value, field *Field) (int, error) {
+	n := f.sizefrom(val, field.Sizefrom)
+	if field.sizeExpr == nil {
+		return n, nil
+	}
+	return field.sizeExpr.length(int64(n))
+}
+
+// intValue returns a new value of v's integer type holding n. Allocating a
+// new int here has fewer side effects (doesn't update the original struct),
+// but it's a wasteful allocation.
+func intValue(v reflect.Value, n int64) (reflect.Value, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v = reflect.New(v.Type()).Elem()
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v = reflect.New(v.Type()).Elem()
+		v.SetUint(uint64(n))
+	default:
+		return v, false
+	}
+	return v, true
+}
+
+// packValue returns the value to pack for field i, substituting the current
+// length of the target for sizeof fields, the constant for const fields, the
+// discriminator of the selected type for union discriminators and the data
+// position for offset fields.
+// start is the position of the struct in the stream.
+func (f Fields) packValue(val reflect.Value, i, start int, options *Options) (reflect.Value, error) {
+	field := f[i]
+	v := val.Field(i)
+	if field.constVal.IsValid() {
+		return field.constVal, nil
+	}
+	if field.unionOf != nil {
+		return f.packDiscriminator(val, field, v)
+	}
+	if field.totalSize || field.span != nil {
+		v, _ := intValue(v, int64(f.spanSize(val, field, start, options)))
+		return v, nil
+	}
+	if field.offsetOf != nil {
+		target := field.offsetOf[0]
+		off := 0
+		if f[target].present(val, options) {
+			off = f.sizeofUntil(val, target, start, options)
+			if f[target].base == baseStart {
+				off += start
+			}
+		}
+		if v, ok := intValue(v, int64(off)); ok {
+			return v, nil
+		}
+		panic(fmt.Sprintf("offset field is not int or uint type: %s, %s", field.Name, v.Type()))
+	}
+	if field.Sizeof == nil {
+		return v, nil
+	}
+	var length int
+	if field.byteSize {
+		length = f.byteSize(val, field.Sizeof[0], options)
+	} else {
+		target := f[field.Sizeof[0]]
+		if target.constVal.IsValid() {
+			length = target.constVal.Len()
+		} else {
+			length = val.FieldByIndex(field.Sizeof).Len()
+		}
+		if target.NullString {
+			length += 1
+		}
+	}
+	n := int64(length)
+	if field.sizeExpr != nil {
+		var err error
+		if n, err = field.sizeExpr.value(length); err != nil {
+			return v, err
+		}
+	}
+	if v, ok := intValue(v, n); ok {
+		return v, nil
+	}
+	panic(fmt.Sprintf("sizeof field is not int or uint type: %s, %s", field.Name, v.Type()))
+}
+
 func (f Fields) Pack(buf []byte, val reflect.Value, options *Options) (int, error) {
 	for val.Kind() == reflect.Ptr {
 		val = val.Elem()
 	}
+	if options.bufCap == 0 {
+		// remember the outermost buffer so nested structs can work out
+		// their position in the stream
+		opts := *options
+		opts.bufCap = cap(buf)
+		options = &opts
+	}
+	start := options.bufCap - cap(buf)
 	pos := 0
-	for i, field := range f {
-		if field == nil {
-			continue
-		}
-		v := val.Field(i)
-		length := field.Len
-		if field.Sizefrom != nil {
-			length = f.sizefrom(val, field.Sizefrom)
-		}
-		if length <= 0 && field.Slice {
-			length = v.Len()
-		}
-		if field.Sizeof != nil {
-			length := val.FieldByIndex(field.Sizeof).Len()
-			sizeofField := f[field.Sizeof[0]]
-			if sizeofField.NullString {
-				length += 1
-			}
-			switch field.kind {
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-				// allocating a new int here has fewer side effects (doesn't update the original struct)
-				// but it's a wasteful allocation
-				// the old method might work if we just cast the temporary int/uint to the target type
-				v = reflect.New(v.Type()).Elem()
-				v.SetInt(int64(length))
-			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-				v = reflect.New(v.Type()).Elem()
-				v.SetUint(uint64(length))
-			default:
-				panic(fmt.Sprintf("sizeof field is not int or uint type: %s, %s", field.Name, v.Type()))
-			}
-		}
-		if n, err := field.Pack(buf[pos:], v, length, options); err != nil {
-			return n, err
-		} else {
+	// offset fields are laid out after the fixed part of the struct
+	for _, offsets := range []bool{false, true} {
+		for i, field := range f {
+			if field == nil || (field.offsetFrom != nil) != offsets {
+				continue
+			}
+			if field.plain && options.Layout == LayoutDefault {
+				n, err := f.packPlain(buf[pos:], val, i, options)
+				if err != nil {
+					return pos, err
+				}
+				pos += n
+				continue
+			}
+			if pad := f.padding(val, i, pos, start, options); pad > 0 {
+				zeroBytes(buf[pos : pos+pad])
+				pos += pad
+			}
+			n, err := f.packField(buf[pos:], val, i, pos, start, options)
+			if err != nil {
+				return pos, err
+			}
 			pos += n
+			if field.byteOrders != nil {
+				// the rest of the struct uses the order the field selects
+				if options, err = field.switchOrder(val.Field(i), options); err != nil {
+					return pos, err
+				}
+			}
+			if field.isVersion {
+				options = field.setVersion(val.Field(i), options)
+			}
 		}
 	}
+	if pad := f.trailing(pos, options); pad > 0 {
+		zeroBytes(buf[pos : pos+pad])
+		pos += pad
+	}
 	return pos, nil
 }
 
+func zeroBytes(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
+
+// packPlain packs the plain field i of val.
+func (f Fields) packPlain(buf []byte, val reflect.Value, i int, options *Options) (int, error) {
+	field := f[i]
+	v := val.Field(i)
+	if field.Sizeof != nil {
+		var err error
+		if v, err = f.packValue(val, i, 0, options); err != nil {
+			return 0, err
+		}
+	}
+	length := field.Len
+	if field.Sizefrom != nil {
+		length = f.sizefrom(val, field.Sizefrom)
+	}
+	if length <= 0 && field.Slice {
+		length = v.Len()
+	}
+	return field.Pack(buf, v, length, options)
+}
+
+func (f Fields) packField(buf []byte, val reflect.Value, i, pos, start int, options *Options) (int, error) {
+	field := f[i]
+	if field.Bits > 0 {
+		// the whole storage unit is packed on its first bit-field
+		if !field.bitHead(options) {
+			return 0, nil
+		} else if options.Layout == LayoutNatural {
+			return f.packCBits(buf, val, field, pos, start, options)
+		}
+		return f.packBits(buf, val, field, start, options)
+	}
+	if !field.present(val, options) {
+		return 0, nil
+	}
+	v, err := f.packValue(val, i, start, options)
+	if err != nil {
+		return 0, err
+	}
+	length := field.Len
+	if ((field.Sizefrom != nil && field.byteSize) || field.rest) && !field.Slice {
+		// a string packs all of its bytes, without a terminator
+		length = 0
+	} else if field.Sizefrom != nil && (field.sizeExpr != nil || field.byteSize) {
+		length = v.Len()
+	} else if field.Sizefrom != nil {
+		length = f.sizefrom(val, field.Sizefrom)
+	}
+	if length <= 0 && field.Slice {
+		length = v.Len()
+	}
+	if field.until != nil {
+		if err := field.until.check(v, field.Name); err != nil {
+			return 0, err
+		}
+	}
+	n, err := field.Pack(buf, v, length, options)
+	if err != nil || field.until == nil {
+		return n, err
+	}
+	m, err := field.packTerm(buf[n:], v, options)
+	return n + m, err
+}
+
 func (f Fields) Unpack(r io.Reader, val reflect.Value, options *Options) error {
 	for val.Kind() == reflect.Ptr {
 		val = val.Elem()
 	}
-	var tmp [8]byte
-	var buf []byte
+	pr := newReader(r)
+	start := pr.pos
+	// a totalsize or sizeof=A..B field bounds the fields it covers, reading
+	// them from cur and skipping whatever they leave unread
+	cur, last := pr, -1
+	var end int64
+	// where fields began and ended, for checking size fields that follow
+	// their range
+	var marks []int64
 	for i, field := range f {
 		if field == nil {
 			continue
 		}
+		if field.plain && options.Layout == LayoutDefault && last < 0 {
+			if err := f.unpackField(pr, val, field, options); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.spanOf != nil && last < 0 {
+			pad := f.padding(val, i, int(pr.pos-start), int(start), options)
+			end = pr.pos + int64(pad) + int64(f.sizefrom(val, field.spanOf))
+			last = f[field.spanOf[0]].span[1]
+			cur = pr.limit(end - pr.pos)
+		}
+		if field.spanMark {
+			if marks == nil {
+				marks = make([]int64, 2*len(f))
+			}
+			marks[2*i] = pr.pos + int64(f.padding(val, i, int(pr.pos-start), int(start), options))
+		}
+		if err := f.unpackAt(cur, val, i, start, options); err != nil {
+			return err
+		}
+		if field.byteOrders != nil {
+			var err error
+			if options, err = field.switchOrder(val.Field(i), options); err != nil {
+				return err
+			}
+		}
+		if field.isVersion {
+			options = field.setVersion(val.Field(i), options)
+		}
+		if field.spanMark {
+			marks[2*i+1] = pr.pos
+		}
+		if field.totalSize && last < 0 {
+			end = start + int64(f.sizefrom(val, []int{i}))
+			if end < pr.pos {
+				return fmt.Errorf("struc: field `%s` holds size %d, but %d bytes were already read", field.Name, end-start, pr.pos-start)
+			}
+			last = len(f)
+			cur = pr.limit(end - pr.pos)
+		}
+		if i == last {
+			if err := pr.skip(int(end - pr.pos)); err != nil {
+				return err
+			}
+			cur, last = pr, -1
+		}
+	}
+	if err := cur.skip(f.trailing(int(pr.pos-start), options)); err != nil {
+		return err
+	}
+	if last >= 0 {
+		if err := pr.skip(int(end - pr.pos)); err != nil {
+			return err
+		}
+	}
+	// size fields that could not bound their fields are checked afterwards
+	for i, field := range f {
+		if field == nil || field.span == nil || field.span[0] > i {
+			continue
+		}
+		want := marks[2*field.span[1]+1] - marks[2*field.span[0]]
+		if n := int64(f.sizefrom(val, []int{i})); n != want {
+			return fmt.Errorf("struc: field `%s` holds size %d, but its fields take %d bytes", field.Name, n, want)
+		}
+	}
+	return nil
+}
+
+// unpackAt unpacks field i of val from r. start is the position of the struct
+// in the stream.
+func (f Fields) unpackAt(r *reader, val reflect.Value, i int, start int64, options *Options) error {
+	field := f[i]
+	if field.Bits > 0 {
+		if !field.bitHead(options) {
+			return nil
+		}
+		if err := r.skip(f.padding(val, i, int(r.pos-start), int(start), options)); err != nil {
+			return err
+		}
+		if options.Layout == LayoutNatural {
+			return f.unpackCBits(r, val, field, int(r.pos-start), options)
+		}
+		return f.unpackBits(r, val, field, options)
+	}
+	if !field.present(val, options) {
 		v := val.Field(i)
-		length := field.Len
-		if field.Sizefrom != nil {
-			length = f.sizefrom(val, field.Sizefrom)
-		}
-		if v.Kind() == reflect.Ptr && !v.Elem().IsValid() {
-			v.Set(reflect.New(v.Type().Elem()))
-		}
-		if field.Type == Struct {
-			if field.Slice {
-				vals := reflect.MakeSlice(v.Type(), length, length)
-				for i := 0; i < length; i++ {
-					v := vals.Index(i)
-
-					// create a new element to unpack into if have a pointer slice
-					if v.Kind() == reflect.Ptr && !v.Elem().IsValid() {
-						v.Set(reflect.New(v.Type().Elem()))
-					}
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	var err error
+	if field.offsetFrom != nil {
+		err = f.unpackOffset(r, val, field, start, options)
+	} else if err = r.skip(f.padding(val, i, int(r.pos-start), int(start), options)); err == nil {
+		err = f.unpackField(r, val, field, options)
+	}
+	if err == nil {
+		err = field.checkConst(val.Field(i), options)
+	}
+	return err
+}
 
-					fields, err := parseFields(v)
-					if err != nil {
-						return err
-					}
-					if err := fields.Unpack(r, v, options); err != nil {
-						return err
-					}
-				}
-				v.Set(vals)
-			} else {
-				// TODO: DRY (we repeat the inner loop above)
-				fields, err := parseFields(v)
-				if err != nil {
-					return err
+// unpackNested unpacks the nested struct val from r. Pack lays out the offset
+// fields of a nested struct inline after its fixed part, so the stream is
+// moved past them to where the fields that follow begin.
+func (f Fields) unpackNested(r *reader, val reflect.Value, options *Options) error {
+	start := r.pos
+	if err := f.Unpack(r, val, options); err != nil {
+		return err
+	}
+	if !f.hasOffsets() {
+		return nil
+	}
+	for val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	end := start + int64(f.sizeofUntil(val, -1, int(start), options))
+	return r.skip(int(end - r.pos))
+}
+
+func (f Fields) hasOffsets() bool {
+	for _, field := range f {
+		if field != nil && field.offsetFrom != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// unpackOffset unpacks the offset field by seeking to the position held in
+// the field it refers to. start is the position of the struct in the stream.
+func (f Fields) unpackOffset(r *reader, val reflect.Value, field *Field, start int64, options *Options) error {
+	off := int64(f.sizefrom(val, field.offsetFrom))
+	if field.base == baseStruct {
+		off += start
+	}
+	sub, restore, err := r.at(off)
+	if err != nil {
+		return err
+	}
+	err = f.unpackField(sub, val, field, options)
+	if rerr := restore(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+func (f Fields) unpackField(r *reader, val reflect.Value, field *Field, options *Options) error {
+	v := val.Field(field.Index)
+	length := field.Len
+	if field.Sizefrom != nil {
+		var err error
+		if length, err = f.lengthFrom(val, field); err != nil {
+			return err
+		}
+		if field.byteSize {
+			return f.unpackBytes(r, val, field, length, options)
+		}
+	}
+	if field.rest {
+		return f.unpackRest(r, val, field, options)
+	}
+	if field.until != nil {
+		return f.unpackUntil(r, val, field, options)
+	}
+	if field.prefix != Invalid {
+		return field.unpackPrefixed(r, v, options)
+	}
+	if v.Kind() == reflect.Ptr && !v.Elem().IsValid() {
+		v.Set(reflect.New(v.Type().Elem()))
+	}
+	if field.Type == Union {
+		return f.unpackUnion(r, val, field, options)
+	} else if field.Type == Struct {
+		if field.Slice {
+			// arrays are unpacked in place
+			vals := v
+			if !field.Array {
+				vals = reflect.MakeSlice(v.Type(), length, length)
+			}
+			for i := 0; i < length; i++ {
+				v := vals.Index(i)
+
+				// create a new element to unpack into if have a pointer slice
+				if v.Kind() == reflect.Ptr && !v.Elem().IsValid() {
+					v.Set(reflect.New(v.Type().Elem()))
 				}
-				if err := fields.Unpack(r, v, options); err != nil {
+
+				if err := field.Fields.unpackNested(r, v, options); err != nil {
 					return err
 				}
 			}
-			continue
+			if !field.Array {
+				v.Set(vals)
+			}
 		} else {
-			typ := field.Type.Resolve(options)
-			if typ == CustomType {
-				if err := v.Addr().Interface().(Custom).Unpack(r, length, options); err != nil {
-					return err
-				}
-			} else if typ == String {
-				if field.Slice {
-					vals := reflect.MakeSlice(v.Type(), length, length)
-					for i := 0; i < length; i++ {
-						v := vals.Index(i)
-
-						// create a new element to unpack into if have a pointer slice
-						if v.Kind() == reflect.Ptr && !v.Elem().IsValid() {
-							v.Set(reflect.New(v.Type().Elem()))
-						}
-
-						s := readString(r, -1)
-						v.SetString(s)
-					}
-					v.Set(vals)
-				} else {
-					max := -1
-					if field.Sizefrom != nil && length != 0 {
-						max = length
-					}
-					s := readString(r, max)
-					v.SetString(s)
+			if err := field.Fields.unpackNested(r, v, options); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	typ := field.Type.Resolve(options)
+	if typ == CustomType {
+		if err := v.Addr().Interface().(Custom).Unpack(r, length, options); err != nil {
+			return err
+		}
+	} else if typ.isVarint() {
+		return field.unpackVarint(r, v, length)
+	} else if typ == String {
+		if field.Slice {
+			vals := reflect.MakeSlice(v.Type(), length, length)
+			for i := 0; i < length; i++ {
+				v := vals.Index(i)
+
+				// create a new element to unpack into if have a pointer slice
+				if v.Kind() == reflect.Ptr && !v.Elem().IsValid() {
+					v.Set(reflect.New(v.Type().Elem()))
 				}
+
+				s := readString(r, -1)
+				v.SetString(s)
+			}
+			v.Set(vals)
+		} else {
+			max := -1
+			if field.Sizefrom != nil && length != 0 {
+				max = length
+			}
+			s := readString(r, max)
+			v.SetString(s)
+		}
+	} else {
+		var buf []byte
+		size := length * typ.Size()
+		if size < 8 {
+			buf = r.tmp[:size]
+		} else {
+			buf = make([]byte, size)
+		}
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		return field.Unpack(buf[:size], v, length, options)
+	}
+	return nil
+}
+
+// unpackBytes unpacks the `bytesizefrom=` field from the next n bytes of r.
+// Slices of structs and strings are decoded one element at a time until all
+// n bytes have been consumed.
+func (f Fields) unpackBytes(r *reader, val reflect.Value, field *Field, n int, options *Options) error {
+	if n < 0 {
+		return fmt.Errorf("struc: negative byte size %d for field `%s`", n, field.Name)
+	}
+	v := val.Field(field.Index)
+	sub := r.limit(int64(n))
+	if field.Type == Struct || (field.Slice && field.IsString()) {
+		end := sub.pos + int64(n)
+		vals := reflect.MakeSlice(v.Type(), 0, 0)
+		for sub.pos < end {
+			pos := sub.pos
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if field.IsString() {
+				elem.SetString(readString(sub, -1))
 			} else {
-				size := length * field.Type.Resolve(options).Size()
-				if size < 8 {
-					buf = tmp[:size]
-				} else {
-					buf = make([]byte, size)
+				e := elem
+				if e.Kind() == reflect.Ptr {
+					e.Set(reflect.New(e.Type().Elem()))
 				}
-				if _, err := io.ReadFull(r, buf); err != nil {
-					return err
-				}
-				err := field.Unpack(buf[:size], v, length, options)
-				if err != nil {
+				if err := field.Fields.Unpack(sub, e, options); err != nil {
+					if err == io.EOF {
+						err = io.ErrUnexpectedEOF
+					}
 					return err
 				}
 			}
+			if sub.pos == pos {
+				return fmt.Errorf("struc: element of field `%s` takes no bytes, so cannot fill its byte size", field.Name)
+			}
+			vals = reflect.Append(vals, elem)
 		}
+		v.Set(vals)
+		return nil
 	}
-	return nil
+	if field.kind == reflect.String && !field.Slice {
+		buf, err := readBytes(sub, int64(n))
+		if err != nil {
+			return err
+		}
+		v.SetString(string(buf))
+		return nil
+	}
+	if field.Type.isVarint() {
+		return field.unpackVarints(sub, v, sub.pos+int64(n))
+	}
+	size := field.Type.Resolve(options).Size()
+	if n%size != 0 {
+		return fmt.Errorf("struc: byte size %d of field `%s` is not a multiple of its %d byte elements", n, field.Name, size)
+	}
+	buf, err := readBytes(sub, int64(n))
+	if err != nil {
+		return err
+	}
+	return field.Unpack(buf, v, n/size, options)
+}
+
+// readBytes reads n bytes from r as they arrive, so a corrupt length cannot
+// allocate more than the input holds.
+func readBytes(r io.Reader, n int64) ([]byte, error) {
+	var data bytes.Buffer
+	if _, err := io.CopyN(&data, r, n); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// unpackRest unpacks the `rest` field from everything left in r, which ends
+// at EOF or at the end of the region bounding the struct.
+func (f Fields) unpackRest(r *reader, val reflect.Value, field *Field, options *Options) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	sub := &reader{r: bytes.NewReader(data), src: r.src, origin: r.origin, pos: r.pos - int64(len(data))}
+	return f.unpackBytes(sub, val, field, len(data), options)
 }
 
 // readString reads a string byte by byte until either max characters are
@@ -243,4 +776,4 @@ func readString(r io.Reader, max int) string {
 		}
 	}
 	return string(stringBuf.Bytes())
-}
\ No newline at end of file
+}
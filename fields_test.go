@@ -2,6 +2,7 @@ package struc
 
 import (
 	"bytes"
+	"io"
 	"reflect"
 	"testing"
 )
@@ -57,3 +58,282 @@ func TestFieldsSizefromBad(t *testing.T) {
 	}()
 	Pack(&buf, &test)
 }
+
+type tlv struct {
+	Type   uint8
+	Length uint8 `struc:"sizeof=Value"`
+	Value  []byte
+}
+
+type byteSizeStruct struct {
+	ListLen uint16 `struc:"uint16,big,bytesizeof=List"`
+	List    []tlv
+	WordLen uint8    `struc:"bytesizeof=Words"`
+	Words   []uint16 `struc:"[]uint16,big"`
+	NameLen uint8    `struc:"bytesizeof=Name"`
+	Name    string
+	TagsLen uint8
+	Tags    []string `struc:"bytesizefrom=TagsLen-1"`
+}
+
+var byteSizeBytes = []byte{
+	0, 7, 1, 1, 0xaa, 2, 2, 0xbb, 0xcc,
+	4, 1, 2, 3, 4,
+	1, 'a',
+	6, 'x', 0, 'y', 'z', 0,
+}
+
+func TestFieldsByteSize(t *testing.T) {
+	in := &byteSizeStruct{
+		List:  []tlv{{1, 0, []byte{0xaa}}, {2, 0, []byte{0xbb, 0xcc}}},
+		Words: []uint16{0x0102, 0x0304},
+		Name:  "a",
+		Tags:  []string{"x", "yz"},
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), byteSizeBytes) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), byteSizeBytes)
+	}
+	out := &byteSizeStruct{}
+	if err := Unpack(bytes.NewReader(byteSizeBytes), out); err != nil {
+		t.Fatal(err)
+	}
+	in.ListLen, in.List[0].Length, in.List[1].Length = 7, 1, 2
+	in.WordLen, in.NameLen, in.TagsLen = 4, 1, 6
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %#v\nwant: %#v", out, in)
+	}
+}
+
+func TestFieldsByteSizeErrors(t *testing.T) {
+	// the second TLV runs past the 6 bytes given to the list
+	bad := append([]byte{}, byteSizeBytes...)
+	bad[1] = 6
+	if err := Unpack(bytes.NewReader(bad), &byteSizeStruct{}); err == nil {
+		t.Fatal("failed to error on element overrunning its byte size")
+	}
+	// 3 bytes do not hold a whole number of uint16
+	bad = append([]byte{}, byteSizeBytes...)
+	bad[9] = 3
+	if err := Unpack(bytes.NewReader(bad), &byteSizeStruct{}); err == nil {
+		t.Fatal("failed to error on partial element")
+	}
+	type array struct {
+		Len  int `struc:"bytesizeof=Data"`
+		Data [4]uint16
+	}
+	if err := Pack(&bytes.Buffer{}, &array{}); err == nil {
+		t.Fatal("failed to reject byte size of an array")
+	}
+	type empty struct {
+		A [0]byte
+	}
+	type emptyList struct {
+		N    uint8 `struc:"bytesizeof=List"`
+		List []empty
+	}
+	if err := Unpack(bytes.NewReader([]byte{2, 0, 0}), &emptyList{}); err == nil {
+		t.Fatal("failed to error on elements that take no bytes")
+	}
+	// huge byte sizes on short input fail without allocating or panicking
+	type wide struct {
+		NameLen uint32 `struc:"uint32,big,bytesizeof=Name"`
+		Name    string
+		DataLen uint64 `struc:"uint64,big,bytesizeof=Data"`
+		Data    []uint16
+	}
+	for _, in := range [][]byte{
+		{0x7f, 0xff, 0xff, 0xff, 'a'},
+		{0, 0, 0, 0, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe, 'a', 'b'},
+	} {
+		if err := Unpack(bytes.NewReader(in), &wide{}); err != io.ErrUnexpectedEOF {
+			t.Fatalf("%#v: expected io.ErrUnexpectedEOF, got %v", in, err)
+		}
+	}
+}
+
+type totalSizeStruct struct {
+	CbSize uint32 `struc:"uint32,totalsize"`
+	Flags  uint16
+	Name   string `struc:"[4]byte"`
+}
+
+func TestFieldsTotalSize(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, &totalSizeStruct{Flags: 1, Name: "abcd"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{10, 0, 0, 0, 1, 0, 'a', 'b', 'c', 'd'}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	// a newer writer appended a field we don't know about
+	r := bytes.NewReader([]byte{12, 0, 0, 0, 1, 0, 'a', 'b', 'c', 'd', 9, 9, 0xff})
+	out := &totalSizeStruct{}
+	if err := Unpack(r, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.CbSize != 12 || out.Name != "abcd" || r.Len() != 1 {
+		t.Fatalf("bad unpack: %#v, %d bytes left", out, r.Len())
+	}
+	// an older writer left Name out
+	err := Unpack(bytes.NewReader([]byte{6, 0, 0, 0, 1, 0, 'a', 'b', 'c', 'd'}), out)
+	if err == nil {
+		t.Fatal("failed to bound the decode by totalsize")
+	}
+}
+
+type spanStruct struct {
+	Magic   uint8
+	HdrLen  uint8 `struc:"sizeof=Kind..Flags"`
+	Kind    uint8
+	Len     uint8 `struc:"sizeof=Data"`
+	Data    []byte
+	Flags   uint16
+	Body    uint8
+	BodyLen uint8 `struc:"sizeof=Magic..Body"`
+}
+
+func TestFieldsSpan(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, &spanStruct{Magic: 0xaa, Data: []byte{1, 2, 3}, Body: 7}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0xaa, 7, 0, 3, 1, 2, 3, 0, 0, 7, 10}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	out := &spanStruct{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.HdrLen != 7 || out.Body != 7 || out.BodyLen != 10 {
+		t.Fatalf("bad unpack: %#v", out)
+	}
+	// the header is two bytes longer than the fields we know
+	long := []byte{0xaa, 9, 0, 3, 1, 2, 3, 0, 0, 0xee, 0xee, 7, 12}
+	if err := Unpack(bytes.NewReader(long), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Body != 7 {
+		t.Fatalf("bad unpack: %#v", out)
+	}
+	long[12] = 10
+	if err := Unpack(bytes.NewReader(long), out); err == nil {
+		t.Fatal("failed to validate sizeof range after its fields")
+	}
+	type headerOnly struct {
+		HdrLen uint8 `struc:"sizeof=Kind..Flags"`
+		Kind   uint8
+		Flags  uint16
+		Body   uint8
+	}
+	h := &headerOnly{}
+	if err := Unpack(bytes.NewReader([]byte{5, 1, 2, 0, 0xee, 0xee, 7}), h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Flags != 2 || h.Body != 7 {
+		t.Fatalf("bad unpack: %#v", h)
+	}
+	type backwards struct {
+		Len  int `struc:"sizeof=B..A"`
+		A, B int
+	}
+	if err := Pack(&bytes.Buffer{}, &backwards{}); err == nil {
+		t.Fatal("failed to reject backwards range")
+	}
+}
+
+type restStruct struct {
+	Kind  uint8
+	Words []uint16 `struc:"[]uint16,big,rest"`
+}
+
+type restRecord struct {
+	Size uint8  `struc:"totalsize"`
+	Data []byte `struc:"[]byte,rest"`
+}
+
+type restList struct {
+	Len     uint8 `struc:"bytesizeof=Records"`
+	Records []restRecord
+	Points  []struct{ X, Y uint8 } `struc:"rest"`
+}
+
+func TestFieldsRest(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, &restStruct{Kind: 1, Words: []uint16{2, 3}}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{1, 0, 2, 0, 3}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	out := &restStruct{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out.Words, []uint16{2, 3}) {
+		t.Fatalf("bad unpack: %#v", out)
+	}
+	if err := Unpack(bytes.NewReader(want[:4]), out); err == nil {
+		t.Fatal("failed to error on partial trailing element")
+	}
+
+	// each record's rest ends where its totalsize says
+	list := &restList{
+		Records: []restRecord{{Data: []byte{1, 2}}, {Data: []byte{3}}},
+		Points:  []struct{ X, Y uint8 }{{4, 5}, {6, 7}},
+	}
+	buf.Reset()
+	if err := Pack(&buf, list); err != nil {
+		t.Fatal(err)
+	}
+	want = []byte{5, 3, 1, 2, 2, 3, 4, 5, 6, 7}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	outList := &restList{}
+	if err := Unpack(bytes.NewReader(want), outList); err != nil {
+		t.Fatal(err)
+	}
+	list.Len, list.Records[0].Size, list.Records[1].Size = 5, 3, 2
+	if !reflect.DeepEqual(list, outList) {
+		t.Fatalf("got: %#v\nwant: %#v", outList, list)
+	}
+
+	// a string runs to the end of input, with no terminator
+	type restString struct {
+		A uint8
+		S string `struc:"rest"`
+	}
+	buf.Reset()
+	if err := Pack(&buf, &restString{A: 1, S: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	want = []byte{1, 'a', 'b', 'c'}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	if size, _ := Sizeof(&restString{A: 1, S: "abc"}); size != len(want) {
+		t.Fatalf("bad size %d", size)
+	}
+	outString := &restString{}
+	if err := Unpack(bytes.NewReader(want), outString); err != nil {
+		t.Fatal(err)
+	}
+	if *outString != (restString{A: 1, S: "abc"}) {
+		t.Fatalf("got: %#v", outString)
+	}
+
+	type sized struct {
+		Len  int    `struc:"sizeof=Data"`
+		Data []byte `struc:"rest"`
+	}
+	if err := Pack(&bytes.Buffer{}, &sized{}); err == nil {
+		t.Fatal("failed to reject rest with a length")
+	}
+}
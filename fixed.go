@@ -0,0 +1,118 @@
+package struc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+)
+
+// Fixed-point types have no constant of their own. Their Type holds the
+// format instead, as fixedBase | signed<<14 | intBits<<7 | fracBits.
+const fixedBase Type = 1 << 16
+
+// rounding modes for packing fixed-point fields
+const (
+	roundEven  = "even"
+	roundTrunc = "trunc"
+)
+
+// fixedRe matches fixed-point type names such as `fixed16.16`, `ufixed8.8`
+// and `q1.15`, which count integer bits (including the sign) and fraction bits.
+var fixedRe = regexp.MustCompile(`^(u?fixed|q)(\d+)\.(\d+)$`)
+
+// lookupType returns the type named in a struc tag.
+func lookupType(name string) (Type, bool) {
+	if typ, ok := typeLookup[name]; ok {
+		return typ, true
+	} else if typ, ok := parseBCD(name); ok {
+		return typ, true
+	}
+	return parseFixed(name)
+}
+
+// parseFixed parses the name of a fixed-point type, which must be 1 to 8
+// bytes wide.
+func parseFixed(name string) (Type, bool) {
+	m := fixedRe.FindStringSubmatch(name)
+	if m == nil {
+		return Invalid, false
+	}
+	intBits, err1 := strconv.Atoi(m[2])
+	fracBits, err2 := strconv.Atoi(m[3])
+	if err1 != nil || err2 != nil {
+		return Invalid, false
+	}
+	width := intBits + fracBits
+	if width == 0 || width > 64 || width%8 != 0 {
+		return Invalid, false
+	}
+	typ := fixedBase | Type(intBits<<7|fracBits)
+	if m[1] != "ufixed" {
+		typ |= 1 << 14
+	}
+	return typ, true
+}
+
+func (t Type) isFixed() bool {
+	return t >= fixedBase && t < fixedBase<<1
+}
+
+// fixedFormat returns the signedness and bit counts of a fixed-point type.
+func (t Type) fixedFormat() (signed bool, intBits, fracBits uint) {
+	return t&(1<<14) != 0, uint(t>>7) & 0x7f, uint(t) & 0x7f
+}
+
+func (t Type) fixedName() string {
+	signed, intBits, fracBits := t.fixedFormat()
+	prefix := "ufixed"
+	if signed {
+		prefix = "fixed"
+	}
+	return fmt.Sprintf("%s%d.%d", prefix, intBits, fracBits)
+}
+
+// packFixed packs the float val into buf as the fixed-point type typ,
+// rounding to even unless the field has `round=trunc`.
+func (f *Field) packFixed(buf []byte, val reflect.Value, typ Type, order binary.ByteOrder) (int, error) {
+	signed, _, fracBits := typ.fixedFormat()
+	width := typ.Size() * 8
+	r := math.Ldexp(val.Float(), int(fracBits))
+	if f.round == roundTrunc {
+		r = math.Trunc(r)
+	} else {
+		r = math.RoundToEven(r)
+	}
+	lo, hi := 0.0, math.Ldexp(1, width)
+	if signed {
+		lo, hi = -math.Ldexp(1, width-1), math.Ldexp(1, width-1)
+	}
+	// written so that NaN fails too
+	if !(r >= lo && r < hi) {
+		return 0, fmt.Errorf("struc: value %g overflows %s field %s", val.Float(), typ, f.Name)
+	}
+	var n uint64
+	if signed {
+		n = uint64(int64(r))
+	} else {
+		n = uint64(r)
+	}
+	putUint(buf, typ, order, n)
+	return typ.Size(), nil
+}
+
+// unpackFixed unpacks the fixed-point type typ from buf into the float val.
+func (f *Field) unpackFixed(buf []byte, val reflect.Value, typ Type, order binary.ByteOrder) {
+	signed, _, fracBits := typ.fixedFormat()
+	n := getUint(buf, typ, order)
+	var v float64
+	if signed {
+		shift := uint(64 - typ.Size()*8)
+		v = float64(int64(n<<shift) >> shift)
+	} else {
+		v = float64(n)
+	}
+	val.SetFloat(math.Ldexp(v, -int(fracBits)))
+}
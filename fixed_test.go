@@ -0,0 +1,104 @@
+package struc
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type fixedPoint struct {
+	Version float64   `struc:"fixed16.16,big"`
+	Scale   float32   `struc:"q2.14,big"`
+	Gain    float64   `struc:"q1.15"`
+	Coeffs  []float32 `struc:"[2]ufixed8.8"`
+}
+
+func TestFixedPoint(t *testing.T) {
+	in := &fixedPoint{1.5, -0.5, -1, []float32{255.99609375, 0.25}}
+	want := []byte{
+		0x00, 0x01, 0x80, 0x00,
+		0xe0, 0x00,
+		0x00, 0x80,
+		0xff, 0xff, 0x40, 0x00,
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	out := &fixedPoint{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %+v\nwant: %+v", out, in)
+	}
+}
+
+type fixedRounding struct {
+	Even  float64 `struc:"q1.15,big"`
+	Trunc float64 `struc:"q1.15,big,round=trunc"`
+}
+
+func TestFixedRounding(t *testing.T) {
+	lsb := math.Ldexp(1, -15)
+	for _, test := range []struct {
+		in   float64
+		even int16
+		trnc int16
+	}{
+		{0.5 * lsb, 0, 0},
+		{1.5 * lsb, 2, 1},
+		{2.5 * lsb, 2, 2},
+		{-1.5 * lsb, -2, -1},
+		{1.7 * lsb, 2, 1},
+	} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, &fixedRounding{test.in, test.in}); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		even, trnc := int16(b[0])<<8|int16(b[1]), int16(b[2])<<8|int16(b[3])
+		if even != test.even || trnc != test.trnc {
+			t.Fatalf("%g lsb: got %d and %d, want %d and %d", test.in/lsb, even, trnc, test.even, test.trnc)
+		}
+	}
+}
+
+func TestFixedErrors(t *testing.T) {
+	type signed struct {
+		A float64 `struc:"q1.15"`
+	}
+	type unsigned struct {
+		A float32 `struc:"ufixed8.8"`
+	}
+	for _, data := range []interface{}{
+		&signed{1},
+		&signed{-1 - math.Ldexp(1, -15)},
+		&signed{math.NaN()},
+		&unsigned{-0.01},
+		&unsigned{256},
+	} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, data); err == nil {
+			t.Fatalf("%+v: packed without error", data)
+		}
+	}
+	type intField struct {
+		A int `struc:"fixed16.16"`
+	}
+	type oddWidth struct {
+		A float64 `struc:"fixed3.4"`
+	}
+	type badRound struct {
+		A float64 `struc:"float64,round=trunc"`
+	}
+	for _, data := range []interface{}{&intField{}, &oddWidth{}, &badRound{}} {
+		if err := parseTest(data); err == nil {
+			t.Fatalf("%T: parsed without error", data)
+		}
+	}
+}
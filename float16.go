@@ -0,0 +1,74 @@
+package struc
+
+import "math"
+
+// float16 and bfloat16 share one encoder, parameterized by the widths of the
+// exponent and fraction.
+const (
+	halfExpBits, halfFracBits = 5, 10
+	bf16ExpBits, bf16FracBits = 8, 7
+)
+
+// packMinifloat encodes v as a binary float with expBits of exponent and
+// fracBits of fraction, rounding to nearest even. Values too large become
+// infinities, and NaNs keep the top bits of their payload.
+func packMinifloat(v float64, expBits, fracBits uint) uint64 {
+	bits := math.Float64bits(v)
+	sign := bits >> 63 << (expBits + fracBits)
+	maxExp := uint64(1)<<expBits - 1
+	if math.IsNaN(v) {
+		// keep the payload, setting the quiet bit so it stays a NaN
+		frac := (bits&(1<<52-1))>>(52-fracBits) | 1<<(fracBits-1)
+		return sign | maxExp<<fracBits | frac
+	} else if math.IsInf(v, 0) {
+		return sign | maxExp<<fracBits
+	} else if v == 0 {
+		return sign
+	}
+	bias := 1<<(expBits-1) - 1
+	frac, exp := math.Frexp(math.Abs(v))
+	e := exp - 1 + bias
+	if e <= 0 {
+		// subnormal, counting in units of the smallest subnormal; rounding
+		// up to 1<<fracBits carries into the exponent as it should
+		return sign | uint64(math.RoundToEven(math.Ldexp(math.Abs(v), int(fracBits)+bias-1)))
+	}
+	n := uint64(math.RoundToEven(math.Ldexp(frac, int(fracBits)+1)))
+	if n == 1<<(fracBits+1) {
+		// rounded up to the next power of two
+		n >>= 1
+		e++
+	}
+	if uint64(e) >= maxExp {
+		return sign | maxExp<<fracBits
+	}
+	return sign | uint64(e)<<fracBits | n&(1<<fracBits-1)
+}
+
+// unpackMinifloat decodes n, encoded by packMinifloat, exactly.
+func unpackMinifloat(n uint64, expBits, fracBits uint) float64 {
+	maxExp := uint64(1)<<expBits - 1
+	bias := 1<<(expBits-1) - 1
+	neg := n>>(expBits+fracBits)&1 != 0
+	e := n >> fracBits & maxExp
+	frac := n & (1<<fracBits - 1)
+	var v float64
+	switch {
+	case e == maxExp && frac != 0:
+		bits := uint64(0x7ff)<<52 | frac<<(52-fracBits)
+		if neg {
+			bits |= 1 << 63
+		}
+		return math.Float64frombits(bits)
+	case e == maxExp:
+		v = math.Inf(1)
+	case e == 0:
+		v = math.Ldexp(float64(frac), 1-bias-int(fracBits))
+	default:
+		v = math.Ldexp(float64(frac|1<<fracBits), int(e)-bias-int(fracBits))
+	}
+	if neg {
+		v = math.Copysign(v, -1)
+	}
+	return v
+}
@@ -0,0 +1,100 @@
+package struc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMinifloatRounding(t *testing.T) {
+	for _, test := range []struct {
+		in   float64
+		half uint16
+		bf16 uint16
+	}{
+		{1, 0x3c00, 0x3f80},
+		{-2, 0xc000, 0xc000},
+		{math.Copysign(0, -1), 0x8000, 0x8000},
+		{65504, 0x7bff, 0x4780},
+		// halfway to 65536 rounds to even, which overflows to infinity
+		{65520, 0x7c00, 0x4780},
+		{math.Inf(-1), 0xfc00, 0xff80},
+		// halfway between 1 and the next value rounds to even
+		{1 + math.Ldexp(1, -11), 0x3c00, 0x3f80},
+		{1 + 3*math.Ldexp(1, -11), 0x3c02, 0x3f80},
+		{1 + math.Ldexp(1, -8), 0x3c04, 0x3f80},
+		{1 + 3*math.Ldexp(1, -8), 0x3c0c, 0x3f82},
+		// subnormals
+		{math.Ldexp(1, -24), 0x0001, 0x3380},
+		{math.Ldexp(1, -25), 0x0000, 0x3300},
+		{math.Ldexp(3, -26), 0x0001, 0x3340},
+		{math.Ldexp(1023, -24), 0x03ff, 0x3880},
+		// the largest subnormal rounds up to the smallest normal
+		{math.Ldexp(2047, -25), 0x0400, 0x3880},
+		{math.Ldexp(1, -133), 0x0000, 0x0001},
+		{math.Pi, 0x4248, 0x4049},
+	} {
+		if half := packMinifloat(test.in, halfExpBits, halfFracBits); half != uint64(test.half) {
+			t.Errorf("float16(%g) = %#04x, want %#04x", test.in, half, test.half)
+		}
+		if bf16 := packMinifloat(test.in, bf16ExpBits, bf16FracBits); bf16 != uint64(test.bf16) {
+			t.Errorf("bfloat16(%g) = %#04x, want %#04x", test.in, bf16, test.bf16)
+		}
+	}
+}
+
+func TestMinifloatRoundTrip(t *testing.T) {
+	// every value decodes and encodes back to itself
+	for _, format := range [][2]uint{{halfExpBits, halfFracBits}, {bf16ExpBits, bf16FracBits}} {
+		for n := uint64(0); n < 1<<16; n++ {
+			v := unpackMinifloat(n, format[0], format[1])
+			back := packMinifloat(v, format[0], format[1])
+			if back != n && !(math.IsNaN(v) && back == n|1<<(format[1]-1)) {
+				t.Fatalf("%d.%d: %#04x decodes to %g, which encodes to %#04x", format[0], format[1], n, v, back)
+			}
+		}
+	}
+}
+
+type halfTensor struct {
+	Count  uint16    `struc:"sizeof=Values"`
+	Values []float32 `struc:"[]float16"`
+	Scale  float64   `struc:"bfloat16,big"`
+	Bias   float32   `struc:"float16,big"`
+}
+
+func TestFloat16Fields(t *testing.T) {
+	in := &halfTensor{Values: []float32{1, -0.5, float32(math.Inf(1))}, Scale: 3.140625, Bias: 65504}
+	want := []byte{3, 0, 0x00, 0x3c, 0x00, 0xb8, 0x00, 0x7c, 0x40, 0x49, 0x7b, 0xff}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	out := &halfTensor{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	in.Count = 3
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %+v\nwant: %+v", out, in)
+	}
+	// Options.Order overrides the field tags
+	buf.Reset()
+	if err := PackWithOptions(&buf, in, &Options{Order: binary.BigEndian}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes()[:4], []byte{0, 3, 0x3c, 0x00}) {
+		t.Fatalf("got: %#v", buf.Bytes())
+	}
+	type intField struct {
+		A int `struc:"float16"`
+	}
+	if err := parseTest(&intField{}); err == nil {
+		t.Fatal("parsed a float16 int field without error")
+	}
+}
@@ -0,0 +1,51 @@
+package struc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+// isSigned reports whether t is a signed integer type.
+func (t Type) isSigned() bool {
+	switch t {
+	case Int8, Int16, Int24, Int32, Int40, Int48, Int56, Int64:
+		return true
+	}
+	return false
+}
+
+// isLittleEndian reports whether order writes the least significant byte
+// first.
+func isLittleEndian(order binary.ByteOrder) bool {
+	var b [2]byte
+	order.PutUint16(b[:], 1)
+	return b[0] == 1
+}
+
+// checkWidth returns an error if the bool or integer val does not fit the
+// odd-width integer type typ.
+func (f *Field) checkWidth(val reflect.Value, typ Type) error {
+	bits := uint(typ.Size() * 8)
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := val.Int()
+		if typ.isSigned() {
+			if n >= -int64(1)<<(bits-1) && n < int64(1)<<(bits-1) {
+				return nil
+			}
+		} else if n >= 0 && n < int64(1)<<bits {
+			return nil
+		}
+		return fmt.Errorf("struc: value %d overflows %s field %s", n, typ, f.Name)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := val.Uint()
+		if typ.isSigned() {
+			bits--
+		}
+		if n >= uint64(1)<<bits {
+			return fmt.Errorf("struc: value %d overflows %s field %s", n, typ, f.Name)
+		}
+	}
+	return nil
+}
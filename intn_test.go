@@ -0,0 +1,105 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type oddInts struct {
+	A int32   `struc:"int24"`
+	B int32   `struc:"int24,big"`
+	C uint64  `struc:"uint40"`
+	D int64   `struc:"int48,big"`
+	E uint64  `struc:"uint56"`
+	N int     `struc:"uint24,sizeof=S"`
+	S []int32 `struc:"[]int24,big"`
+}
+
+func TestOddInts(t *testing.T) {
+	in := &oddInts{
+		A: -2,
+		B: 0x123456,
+		C: 0x0102030405,
+		D: -0x010203040506,
+		E: 0xffffffffffffff,
+		S: []int32{-8388608, 8388607},
+	}
+	want := []byte{
+		0xfe, 0xff, 0xff,
+		0x12, 0x34, 0x56,
+		0x05, 0x04, 0x03, 0x02, 0x01,
+		0xfe, 0xfd, 0xfc, 0xfb, 0xfa, 0xfa,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x02, 0x00, 0x00,
+		0x80, 0x00, 0x00, 0x7f, 0xff, 0xff,
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	if size, _ := Sizeof(in); size != len(want) {
+		t.Fatalf("bad size %d", size)
+	}
+	out := &oddInts{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	in.N = 2
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %+v\nwant: %+v", out, in)
+	}
+}
+
+func TestOddIntOverflow(t *testing.T) {
+	type signed struct {
+		A int `struc:"int24"`
+	}
+	type unsigned struct {
+		A uint `struc:"uint24"`
+	}
+	for _, data := range []interface{}{
+		&signed{1 << 23},
+		&signed{-1<<23 - 1},
+		&unsigned{1 << 24},
+	} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, data); err == nil {
+			t.Fatalf("%+v: packed without error", data)
+		}
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, &signed{-1 << 23}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Pack(&buf, &unsigned{1<<24 - 1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type oddBitFields struct {
+	A uint8  `struc:"uint24,big,bits=4"`
+	B uint32 `struc:"uint24,big,bits=20"`
+}
+
+func TestOddIntBitFields(t *testing.T) {
+	in := &oddBitFields{0xa, 0x12345}
+	want := []byte{0xa1, 0x23, 0x45}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v", buf.Bytes())
+	}
+	out := &oddBitFields{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	if *out != *in {
+		t.Fatalf("got: %+v", out)
+	}
+}
@@ -0,0 +1,137 @@
+package struc
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Layout selects how fields are positioned within a struct.
+type Layout int
+
+const (
+	// LayoutDefault packs fields back to back with no padding.
+	LayoutDefault Layout = iota
+	// LayoutNatural pads each field to its natural alignment and pads the
+	// struct to a multiple of its alignment, the way gcc and clang lay out
+	// C structs.
+	LayoutNatural
+)
+
+// isDirective reports whether the tag of a blank `_` field holds struct
+// directives rather than describing the field, such as `[4]pad`.
+func isDirective(tagStr string) bool {
+	for _, s := range strings.Split(tagStr, ",") {
+		if s != "" && s != "packed" && !strings.HasPrefix(s, "pack=") {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDirective parses the tag of a blank `_` field, which holds settings
+// for the whole struct:
+//
+//	_ struct{} `struc:"packed"` // like __attribute__((packed))
+//	_ struct{} `struc:"pack=2"` // like #pragma pack(2)
+func parseDirective(tagStr string) (packAlign int, err error) {
+	for _, s := range strings.Split(tagStr, ",") {
+		if s == "" {
+			continue
+		} else if s == "packed" {
+			packAlign = 1
+		} else if strings.HasPrefix(s, "pack=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(s, "pack="))
+			if err != nil || n <= 0 || n&(n-1) != 0 {
+				return 0, fmt.Errorf("struc: invalid `%s`, must be a power of two", s)
+			}
+			packAlign = n
+		} else {
+			return 0, fmt.Errorf("struc: unknown struct directive `%s`", s)
+		}
+	}
+	return packAlign, nil
+}
+
+func alignUp(pos, align int) int {
+	if align <= 1 {
+		return pos
+	}
+	return (pos + align - 1) / align * align
+}
+
+// align returns the alignment a C compiler would give f, capped by the
+// `packed` or `pack=N` directive of its struct.
+func (f *Field) align(options *Options) int {
+	var align int
+	switch typ := f.Type.Resolve(options); typ {
+	case Struct:
+		align = f.Fields.align(options)
+	case Int16, Uint16, Int32, Uint32, Int64, Uint64, Binary16, BFloat16, Float32, Float64:
+		align = typ.Size()
+	default:
+		align = 1
+		if typ.isTime() {
+			align = typ.Size()
+		} else if typ.isFixed() {
+			// fixed-point values are stored in C integers of the same width
+			if n := typ.Size(); n&(n-1) == 0 {
+				align = n
+			}
+		}
+	}
+	if f.packAlign > 0 && align > f.packAlign {
+		align = f.packAlign
+	}
+	if f.alignTo > align && !f.alignStart {
+		align = f.alignTo
+	}
+	return align
+}
+
+// align returns the alignment of the struct, which is that of its most
+// aligned field.
+func (f Fields) align(options *Options) int {
+	align := 1
+	for _, field := range f {
+		if field != nil {
+			if a := field.align(options); a > align {
+				align = a
+			}
+		}
+	}
+	return align
+}
+
+// padding returns the number of bytes inserted before field i of val when it
+// starts at pos, relative to the start of the struct. start is the position
+// of the struct in the stream, used by `align=N,base=start` fields.
+func (f Fields) padding(val reflect.Value, i, pos, start int, options *Options) int {
+	field := f[i]
+	if (field.Bits > 0 && !field.bitHead(options)) || !field.present(val, options) {
+		return 0
+	}
+	pad := 0
+	// bit-fields need no padding of their own, see cBitRun
+	if options.Layout == LayoutNatural && field.Bits == 0 {
+		pad = alignUp(pos, field.align(options)) - pos
+	}
+	if field.alignTo > 1 {
+		at := pos + pad
+		if field.alignStart {
+			at += start
+		}
+		pad += alignUp(at, field.alignTo) - at
+	}
+	return pad
+}
+
+// trailing returns the number of bytes padding a struct of size pos to a
+// multiple of its alignment.
+func (f Fields) trailing(pos int, options *Options) int {
+	if options.Layout != LayoutNatural {
+		return 0
+	}
+	return alignUp(pos, f.align(options)) - pos
+}
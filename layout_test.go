@@ -0,0 +1,252 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var naturalOptions = &Options{Layout: LayoutNatural}
+
+type cCharInt struct {
+	A int8
+	B int32
+}
+
+type cCharDoubleChar struct {
+	A int8
+	D float64
+	C int8
+}
+
+type cInner struct {
+	S int16
+	X uint8
+}
+
+type cOuter struct {
+	C     uint8
+	In    cInner
+	Arr   [2]cInner
+	Count Size_t
+}
+
+type cPacked struct {
+	_ struct{} `struc:"packed"`
+	A int8
+	B int32
+}
+
+type cPack2 struct {
+	_ struct{} `struc:"pack=2"`
+	A int8
+	B int32
+	C int8
+}
+
+type cPackedMember struct {
+	A  int8
+	In cPacked
+	B  int16
+}
+
+type cBits struct {
+	A uint8  `struc:"uint8,bits=3"`
+	B uint8  `struc:"uint8,bits=5"`
+	C uint32 `struc:"uint32,bits=20"`
+	D uint8
+}
+
+// F does not fit in the rest of the uint16 holding E, so starts the next one
+type cBitsSpill struct {
+	E uint8  `struc:"uint8,bits=7"`
+	F uint16 `struc:"uint16,bits=10"`
+}
+
+type cBitsPacked struct {
+	_ struct{} `struc:"packed"`
+	E uint8    `struc:"uint8,bits=7"`
+	F uint16   `struc:"uint16,bits=10"`
+}
+
+type cBitsBig struct {
+	_ BigEndian
+	A uint8  `struc:"uint8,bits=3"`
+	B uint16 `struc:"uint16,bits=9"`
+}
+
+func TestNaturalLayoutSizeof(t *testing.T) {
+	tests := []struct {
+		data    interface{}
+		size    int
+		ptrSize int
+	}{
+		{&cCharInt{}, 8, 32},
+		{&cCharDoubleChar{}, 24, 32},
+		{&cInner{}, 4, 32},
+		{&cOuter{}, 20, 32},
+		{&cOuter{}, 24, 64},
+		{&cPacked{}, 5, 32},
+		{&cPack2{}, 8, 32},
+		{&cPackedMember{}, 8, 32},
+		{&cBits{}, 8, 32},
+		{&cBitsSpill{}, 4, 32},
+		{&cBitsPacked{}, 3, 32},
+		{&cBitsBig{}, 2, 32},
+	}
+	for _, test := range tests {
+		options := &Options{Layout: LayoutNatural, PtrSize: test.ptrSize}
+		size, err := SizeofWithOptions(test.data, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != test.size {
+			t.Errorf("%T: expected size %d, got %d", test.data, test.size, size)
+		}
+		var buf bytes.Buffer
+		if err := PackWithOptions(&buf, test.data, options); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != test.size {
+			t.Errorf("%T: packed %d bytes, expected %d", test.data, buf.Len(), test.size)
+		}
+	}
+}
+
+func TestNaturalLayoutCodec(t *testing.T) {
+	in := &cOuter{
+		C:     1,
+		In:    cInner{0x0203, 4},
+		Arr:   [2]cInner{{5, 6}, {7, 8}},
+		Count: 9,
+	}
+	ref := []byte{
+		1, 0, // C, padding
+		3, 2, 4, 0, // In
+		5, 0, 6, 0, 7, 0, 8, 0, // Arr
+		0, 0, // padding
+		9, 0, 0, 0, // Count
+	}
+	var buf bytes.Buffer
+	if err := PackWithOptions(&buf, in, naturalOptions); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), ref) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), ref)
+	}
+	out := &cOuter{}
+	if err := UnpackWithOptions(&buf, out, naturalOptions); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %#v\nwant: %#v", out, in)
+	}
+}
+
+func TestNaturalLayoutBits(t *testing.T) {
+	for _, test := range []struct {
+		in, out interface{}
+		want    []byte
+	}{
+		// A and B share the first byte, and C the rest of its uint32
+		{&cBits{5, 17, 0xabcde, 9}, &cBits{}, []byte{0x8d, 0xde, 0xbc, 0x0a, 9, 0, 0, 0}},
+		{&cBitsSpill{0x7f, 0x3ff}, &cBitsSpill{}, []byte{0x7f, 0, 0xff, 0x03}},
+		{&cBitsPacked{E: 0x7f, F: 0x3ff}, &cBitsPacked{}, []byte{0xff, 0xff, 0x01}},
+		// big-endian bit-fields are allocated from the most significant bit
+		{&cBitsBig{A: 5, B: 0x1ff}, &cBitsBig{}, []byte{0xbf, 0xf0}},
+	} {
+		var buf bytes.Buffer
+		if err := PackWithOptions(&buf, test.in, naturalOptions); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), test.want) {
+			t.Fatalf("%T: got: %#v\nwant: %#v", test.in, buf.Bytes(), test.want)
+		}
+		if err := UnpackWithOptions(&buf, test.out, naturalOptions); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(test.in, test.out) {
+			t.Fatalf("got: %#v\nwant: %#v", test.out, test.in)
+		}
+	}
+}
+
+type badDirective struct {
+	_ struct{} `struc:"pack=3"`
+	A int8
+}
+
+func TestBadDirective(t *testing.T) {
+	if err := parseTest(&badDirective{}); err == nil {
+		t.Fatal("failed to error on invalid pack directive")
+	}
+}
+
+// a blank field with a field tag is a field, not a directive
+type blankPad struct {
+	A int8
+	_ [4]byte `struc:"[4]pad"`
+	B int8
+}
+
+func TestBlankFieldTag(t *testing.T) {
+	if err := parseTest(&blankPad{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type alignedAttr struct {
+	Kind    uint8
+	Payload uint32 `struc:"uint32,align=4"`
+}
+
+type alignedStream struct {
+	Kind  uint8
+	Value uint16 `struc:"uint16,align=4,base=start"`
+}
+
+type alignedOuter struct {
+	Tag    uint8
+	Attr   alignedAttr
+	Stream alignedStream
+	List   [2]alignedStream
+}
+
+func TestAlignField(t *testing.T) {
+	in := &alignedOuter{
+		Tag:    1,
+		Attr:   alignedAttr{2, 3},
+		Stream: alignedStream{4, 5},
+		List:   [2]alignedStream{{6, 7}, {8, 9}},
+	}
+	want := []byte{
+		1,
+		2, 0, 0, 0, 3, 0, 0, 0, // aligned within Attr, which starts at 1
+		4, 0, 0, 5, 0, // Stream starts at 9, Value aligned to 12
+		6, 0, 7, 0, // List[0] starts at 14, Value aligned to 16
+		8, 0, 9, 0, // List[1] starts at 18, Value aligned to 20
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	if size, _ := Sizeof(in); size != len(want) {
+		t.Fatalf("bad size: %d", size)
+	}
+	out := &alignedOuter{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %#v\nwant: %#v", out, in)
+	}
+	type badAlign struct {
+		A int `struc:"align=3"`
+	}
+	if err := Pack(&buf, &badAlign{}); err == nil {
+		t.Fatal("failed to reject align=3")
+	}
+}
@@ -0,0 +1,114 @@
+package struc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BigEndian and LittleEndian set the default byte order of every field in a
+// struct, including nested structs that do not set their own, when used as
+// the type of a blank field. Field tags still override it.
+//
+//	type Header struct {
+//		_    struc.BigEndian
+//		Size uint32
+//	}
+type BigEndian struct{}
+
+// LittleEndian is the counterpart of BigEndian.
+type LittleEndian struct{}
+
+// ByteOrderer is implemented by structs that set the default byte order of
+// their fields, like a BigEndian or LittleEndian blank field.
+type ByteOrderer interface {
+	StrucByteOrder() binary.ByteOrder
+}
+
+var (
+	bigEndianType    = reflect.TypeOf(BigEndian{})
+	littleEndianType = reflect.TypeOf(LittleEndian{})
+)
+
+// structOrder returns the default byte order declared by the struct type t,
+// or nil if it does not declare one.
+func structOrder(t reflect.Type) binary.ByteOrder {
+	if bo, ok := reflect.New(t).Interface().(ByteOrderer); ok {
+		return bo.StrucByteOrder()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if field := t.Field(i); field.Name == "_" {
+			switch field.Type {
+			case bigEndianType:
+				return binary.BigEndian
+			case littleEndianType:
+				return binary.LittleEndian
+			}
+		}
+	}
+	return nil
+}
+
+// orderCase is one `value:order` pair from a `byteorder=` tag.
+type orderCase struct {
+	value reflect.Value
+	order binary.ByteOrder
+}
+
+// orderCaseRe matches the `value:order` pairs following `byteorder=`.
+var orderCaseRe = regexp.MustCompile(`^[^=:]+:(big|little)$`)
+
+// parseOrderCases parses the pairs from a `byteorder=II:little,MM:big` tag on
+// a field of type t. Values are literals as in `const=`, except that string
+// and byte fields also accept them unquoted.
+func parseOrderCases(pairs []string, t reflect.Type) ([]orderCase, error) {
+	var cases []orderCase
+	for _, pair := range pairs {
+		i := strings.LastIndex(pair, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("struc: invalid `byteorder=` case `%s`, must be value:big or value:little", pair)
+		}
+		lit, name := pair[:i], pair[i+1:]
+		var order binary.ByteOrder
+		switch name {
+		case "big":
+			order = binary.BigEndian
+		case "little":
+			order = binary.LittleEndian
+		default:
+			return nil, fmt.Errorf("struc: invalid `byteorder=` case `%s`, must be value:big or value:little", pair)
+		}
+		kind := t.Kind()
+		if kind == reflect.Array || kind == reflect.Slice {
+			kind = t.Elem().Kind()
+		}
+		if (kind == reflect.String || kind == reflect.Uint8 && t.Kind() != reflect.Uint8) && !strings.HasPrefix(lit, `"`) {
+			lit = strconv.Quote(lit)
+		}
+		v, err := parseConst(lit, t)
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, orderCase{v, order})
+	}
+	return cases, nil
+}
+
+// switchOrder returns options with Order set by the `byteorder=` field f,
+// whose value is v.
+func (f *Field) switchOrder(v reflect.Value, options *Options) (*Options, error) {
+	for _, c := range f.byteOrders {
+		if reflect.DeepEqual(v.Interface(), c.value.Interface()) {
+			if options.Order == c.order {
+				return options, nil
+			}
+			opts := *options
+			opts.Order = c.order
+			return &opts, nil
+		}
+	}
+	return nil, fmt.Errorf("struc: field %s holds %#v, which is not a known byte order marker", f.Name, v.Interface())
+}
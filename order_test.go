@@ -0,0 +1,117 @@
+package struc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+type orderInner struct {
+	A uint16
+}
+
+type orderOwn struct {
+	B uint16
+}
+
+func (orderOwn) StrucByteOrder() binary.ByteOrder {
+	return binary.LittleEndian
+}
+
+type orderOuter struct {
+	_     BigEndian
+	X     uint16
+	Y     uint16 `struc:"little"`
+	Inner orderInner
+	Own   orderOwn
+	Ptrs  [1]*orderInner
+}
+
+func TestStructByteOrder(t *testing.T) {
+	in := &orderOuter{X: 1, Y: 2, Inner: orderInner{3}, Own: orderOwn{4}, Ptrs: [1]*orderInner{{5}}}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 1, 2, 0, 0, 3, 4, 0, 0, 5}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	out := &orderOuter{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %#v\nwant: %#v", out, in)
+	}
+	// the same inner type on its own is still little endian
+	buf.Reset()
+	if err := Pack(&buf, &orderInner{3}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{3, 0}) {
+		t.Fatalf("inner struct lost its default order: %#v", buf.Bytes())
+	}
+	// Options.Order still overrides everything
+	buf.Reset()
+	if err := PackWithOptions(&buf, in, &Options{Order: binary.LittleEndian}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{1, 0, 2, 0, 3, 0, 4, 0, 5, 0}) {
+		t.Fatalf("Options.Order did not override: %#v", buf.Bytes())
+	}
+}
+
+type tiffEntry struct {
+	Tag   uint16
+	Count uint32
+}
+
+type tiffHeader struct {
+	BOM    string `struc:"[2]byte,byteorder=II:little,MM:big"`
+	Magic  uint16
+	Offset uint32
+	Entry  tiffEntry
+	Raw    uint16 `struc:"uint16,little"`
+}
+
+type pcapHeader struct {
+	Magic   uint32 `struc:"uint32,byteorder=0xa1b2c3d4:little,0xd4c3b2a1:big"`
+	Version uint16
+}
+
+func TestSwitchByteOrder(t *testing.T) {
+	for _, test := range []struct {
+		in   tiffHeader
+		want []byte
+	}{
+		{tiffHeader{"II", 42, 8, tiffEntry{1, 2}, 3}, []byte("II\x2a\x00\x08\x00\x00\x00\x01\x00\x02\x00\x00\x00\x03\x00")},
+		{tiffHeader{"MM", 42, 8, tiffEntry{1, 2}, 3}, []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01\x00\x00\x00\x02\x00\x03")},
+	} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, &test.in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), test.want) {
+			t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), test.want)
+		}
+		out := &tiffHeader{}
+		if err := Unpack(bytes.NewReader(test.want), out); err != nil {
+			t.Fatal(err)
+		}
+		if *out != test.in {
+			t.Fatalf("got: %#v\nwant: %#v", out, test.in)
+		}
+	}
+	out := &pcapHeader{}
+	if err := Unpack(bytes.NewReader([]byte{0xa1, 0xb2, 0xc3, 0xd4, 0, 2}), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Magic != 0xd4c3b2a1 || out.Version != 2 {
+		t.Fatalf("bad unpack: %#v", out)
+	}
+	if err := Unpack(bytes.NewReader([]byte("XX\x00\x2a\x00\x00\x00\x08\x00\x01\x00\x00\x00\x02\x00\x03")), &tiffHeader{}); err == nil {
+		t.Fatal("failed to reject unknown byte order marker")
+	}
+}
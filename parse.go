@@ -9,22 +9,86 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // struc:"int32,big,sizeof=Data,skip,sizefrom=Len"
+// struc:"sizefrom=(IHL*4)-20"
+// struc:"bytesizeof=Records"
+// struc:"uint32,totalsize"
+// struc:"uint16,sizeof=Header..Flags"
+// struc:"[]byte,rest"
+// struc:"[]Entry,until=Type==0xFF,keepterm"
+// struc:"[16]byte,pad=\" \""
+// struc:"[16]byte,cstring,strict"
+// struc:"pstring=uint16,big"
+// struc:"uint64,align=8,base=start"
+// struc:"[2]byte,byteorder=II:little,MM:big"
+// struc:"uint8,version"
+// struc:"uint32,since=3,before=5"
+// struc:"uint8,bits=4,lsbfirst"
+// struc:"uint32,if=Flags&0x04"
+// struc:"union=MsgType"
+// struc:"offsetfrom=ShdrOff,base=start"
+// struc:"[4]byte,const=\"PK\\x03\\x04\""
 
 type strucTag struct {
-	Type     string
-	Order    binary.ByteOrder
-	Sizeof   string
-	Skip     bool
-	Sizefrom string
+	Type       string
+	Order      binary.ByteOrder
+	Sizeof     string
+	Skip       bool
+	Sizefrom   string
+	Bits       int
+	LSBFirst   bool
+	If         string
+	Union      string
+	Offsetfrom string
+	Base       string
+	Const      string
+	ByteSize   bool
+	TotalSize  bool
+	Rest       bool
+	Until      string
+	KeepTerm   bool
+	Pad        string
+	CString    bool
+	Trim       bool
+	Strict     bool
+	Pstring    string
+	Align      int
+	ByteOrder  []string
+	Since      int
+	Before     int
+	Version    bool
+	Round      string
+	Sign       bool
+	Tz         string
 }
 
-func parseStrucTag(tag reflect.StructTag) *strucTag {
-	t := &strucTag{
-		Order: binary.LittleEndian,
+// splitTag splits a struc tag on commas, except inside quoted strings.
+func splitTag(tag string) []string {
+	var out []string
+	quoted, escaped := false, false
+	last := 0
+	for i := 0; i < len(tag); i++ {
+		switch c := tag[i]; {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			out = append(out, tag[last:i])
+			last = i + 1
+		}
 	}
+	return append(out, tag[last:])
+}
+
+// parseStrucTag parses the struc tag of a field of type typ.
+func parseStrucTag(tag reflect.StructTag, typ reflect.Type) (*strucTag, error) {
+	t := &strucTag{}
 	tagStr := tag.Get("struc")
 	if tagStr == "" {
 		// someone's going to typo this (I already did once)
@@ -32,37 +96,154 @@ func parseStrucTag(tag reflect.StructTag) *strucTag {
 		// and you're mad at me now
 		tagStr = tag.Get("struct")
 	}
-	for _, s := range strings.Split(tagStr, ",") {
+	seen := make(map[string]string)
+	for _, s := range splitTag(tagStr) {
+		if t.ByteOrder != nil && orderCaseRe.MatchString(s) {
+			// the cases of byteorder= are separated by commas too
+			t.ByteOrder = append(t.ByteOrder, s)
+			continue
+		} else if s == "" {
+			continue
+		}
+		if err := checkTagToken(s, seen, typ); err != nil {
+			return t, err
+		}
 		if strings.HasPrefix(s, "sizeof=") {
 			tmp := strings.SplitN(s, "=", 2)
 			t.Sizeof = tmp[1]
 		} else if strings.HasPrefix(s, "sizefrom=") {
 			tmp := strings.SplitN(s, "=", 2)
 			t.Sizefrom = tmp[1]
+		} else if strings.HasPrefix(s, "bytesizeof=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Sizeof = tmp[1]
+			t.ByteSize = true
+		} else if strings.HasPrefix(s, "bytesizefrom=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Sizefrom = tmp[1]
+			t.ByteSize = true
+		} else if strings.HasPrefix(s, "bits=") {
+			tmp := strings.SplitN(s, "=", 2)
+			bits, err := strconv.Atoi(tmp[1])
+			if err != nil || bits <= 0 {
+				return t, fmt.Errorf("struc: invalid bit-field width `%s`", s)
+			}
+			t.Bits = bits
+		} else if strings.HasPrefix(s, "const=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Const = tmp[1]
+		} else if strings.HasPrefix(s, "offsetfrom=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Offsetfrom = tmp[1]
+		} else if strings.HasPrefix(s, "base=") {
+			tmp := strings.SplitN(s, "=", 2)
+			if tmp[1] != baseStart && tmp[1] != baseStruct {
+				return t, fmt.Errorf("struc: invalid `%s`, must be `base=%s` or `base=%s`", s, baseStart, baseStruct)
+			}
+			t.Base = tmp[1]
+		} else if strings.HasPrefix(s, "union=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Union = tmp[1]
+		} else if strings.HasPrefix(s, "if=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.If = tmp[1]
+		} else if s == "msbfirst" {
+			t.LSBFirst = false
+		} else if s == "lsbfirst" {
+			t.LSBFirst = true
 		} else if s == "big" {
 			t.Order = binary.BigEndian
 		} else if s == "little" {
 			t.Order = binary.LittleEndian
+		} else if strings.HasPrefix(s, "pad=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Pad = tmp[1]
+		} else if strings.HasPrefix(s, "until=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Until = tmp[1]
+		} else if strings.HasPrefix(s, "since=") || strings.HasPrefix(s, "before=") {
+			tmp := strings.SplitN(s, "=", 2)
+			n, err := strconv.Atoi(tmp[1])
+			if err != nil || n <= 0 {
+				return t, fmt.Errorf("struc: invalid version in `%s`", s)
+			}
+			if tmp[0] == "since" {
+				t.Since = n
+			} else {
+				t.Before = n
+			}
+		} else if s == "sign" {
+			t.Sign = true
+		} else if s == "version" {
+			t.Version = true
+		} else if strings.HasPrefix(s, "byteorder=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.ByteOrder = []string{tmp[1]}
+		} else if strings.HasPrefix(s, "align=") {
+			tmp := strings.SplitN(s, "=", 2)
+			n, err := strconv.Atoi(tmp[1])
+			if err != nil || n <= 0 || n&(n-1) != 0 {
+				return t, fmt.Errorf("struc: invalid `%s`, must be a power of two", s)
+			}
+			t.Align = n
+		} else if strings.HasPrefix(s, "tz=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Tz = tmp[1]
+		} else if strings.HasPrefix(s, "round=") {
+			tmp := strings.SplitN(s, "=", 2)
+			if tmp[1] != roundEven && tmp[1] != roundTrunc {
+				return t, fmt.Errorf("struc: invalid `%s`, must be `round=%s` or `round=%s`", s, roundEven, roundTrunc)
+			}
+			t.Round = tmp[1]
+		} else if strings.HasPrefix(s, "pstring=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Pstring = tmp[1]
+		} else if s == "cstring" {
+			t.CString = true
+		} else if s == "trim" {
+			t.Trim = true
+		} else if s == "strict" {
+			t.Strict = true
+		} else if s == "keepterm" {
+			t.KeepTerm = true
+		} else if s == "rest" {
+			t.Rest = true
+		} else if s == "totalsize" {
+			t.TotalSize = true
 		} else if s == "skip" {
 			t.Skip = true
 		} else {
 			t.Type = s
 		}
 	}
-	return t
+	return t, nil
 }
 
 var typeLenRe = regexp.MustCompile(`^\[(\d*)\]`)
 
-func parseField(f reflect.StructField) (fd *Field, tag *strucTag, err error) {
-	tag = parseStrucTag(f.Tag)
+// identRe matches a plain field name, as opposed to a size expression.
+var identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseField parses the struct field f, using order unless its tag sets one.
+func parseField(f reflect.StructField, order binary.ByteOrder) (fd *Field, tag *strucTag, err error) {
+	if tag, err = parseStrucTag(f.Tag, f.Type); err != nil {
+		if te, ok := err.(*TagError); ok {
+			te.Field = f.Name
+		}
+		return
+	}
+	if tag.Order != nil {
+		order = tag.Order
+	}
 	var ok bool
 	fd = &Field{
-		Name:  f.Name,
-		Len:   1,
-		Order: tag.Order,
-		Slice: false,
-		kind:  f.Type.Kind(),
+		Name:     f.Name,
+		Len:      1,
+		Order:    order,
+		Slice:    false,
+		Bits:     tag.Bits,
+		lsbFirst: tag.LSBFirst,
+		kind:     f.Type.Kind(),
 	}
 	switch fd.kind {
 	case reflect.Array:
@@ -101,11 +282,19 @@ func parseField(f reflect.StructField) (fd *Field, tag *strucTag, err error) {
 		fd.Bitmap = tmp.Interface().(Bitmapper).GetMap()
 	}
 
+	if fd.kind == reflect.Interface && tag.Union != "" && !fd.Slice && !fd.Ptr {
+		fd.Type = Union
+		if fd.union = f.Type; unionLookup(f.Type) == nil {
+			err = fmt.Errorf("struc: no union types registered for %s (field `%s`)", f.Type, f.Name)
+		}
+		return
+	}
+
 	var defTypeOk bool
 	fd.defType, defTypeOk = reflectTypeMap[fd.kind]
 	// find a type in the struct tag
 	pureType := typeLenRe.ReplaceAllLiteralString(tag.Type, "")
-	if fd.Type, ok = typeLookup[pureType]; ok {
+	if fd.Type, ok = lookupType(pureType); ok {
 		fd.Len = 1
 		match := typeLenRe.FindAllStringSubmatch(tag.Type, -1)
 		if len(match) > 0 && len(match[0]) > 1 {
@@ -136,7 +325,10 @@ func parseField(f reflect.StructField) (fd *Field, tag *strucTag, err error) {
 	return
 }
 
-func parseFieldsLocked(v reflect.Value) (Fields, error) {
+// parseFieldsLocked parses the fields of the struct v. Fields default to the
+// byte order declared by the struct, then to order inherited from the
+// enclosing struct, then to little endian.
+func parseFieldsLocked(v reflect.Value, order binary.ByteOrder) (Fields, error) {
 	// we need to repeat this logic because parseFields() below can't be recursively called due to locking
 	for v.Kind() == reflect.Ptr {
 		v = v.Elem()
@@ -145,11 +337,39 @@ func parseFieldsLocked(v reflect.Value) (Fields, error) {
 	if v.NumField() < 1 {
 		return nil, errors.New("struc: Struct has no fields.")
 	}
+	if own := structOrder(t); own != nil {
+		order = own
+	} else if order == nil {
+		order = binary.LittleEndian
+	}
 	sizeofMap := make(map[string][]int)
+	// the sizeof field tracking each target, by target name
+	sizeofFields := make(map[string]*Field)
 	fields := make(Fields, v.NumField())
+	// the storage unit currently being filled by consecutive bit-fields
+	// bitUnit holds the storage unit of the default layout and bitRun the
+	// consecutive bit-fields LayoutNatural places together
+	var bitUnit, bitRun *Field
+	bitsUsed := 0
+	packAlign := 0
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
-		f, tag, err := parseField(field)
+		if field.Name == "_" && isDirective(field.Tag.Get("struc")) {
+			// blank fields hold directives for the whole struct
+			n, err := parseDirective(field.Tag.Get("struc"))
+			if err != nil {
+				return nil, err
+			} else if n > 0 {
+				packAlign = n
+			}
+			continue
+		}
+		f, tag, err := parseField(field, order)
+		if te, ok := err.(*TagError); ok {
+			// report bad tags even on skipped fields
+			te.Struct = t.Name()
+			return nil, te
+		}
 		if tag.Skip {
 			continue
 		}
@@ -160,27 +380,292 @@ func parseFieldsLocked(v reflect.Value) (Fields, error) {
 			continue
 		}
 		f.Index = i
-		if tag.Sizeof != "" {
+		if tag.If != "" {
+			if f.Bits > 0 {
+				return nil, fmt.Errorf("struc: bit-field `%s` cannot be conditional", field.Name)
+			}
+			if f.cond, err = parseExpr(tag.If, t); err != nil {
+				return nil, err
+			}
+			// conditions are evaluated during Unpack, so they can only see fields decoded before them
+			for _, index := range f.cond.fields() {
+				if index[0] >= i {
+					return nil, fmt.Errorf("struc: `if=%s` on field `%s` must only refer to earlier fields", tag.If, field.Name)
+				}
+			}
+		}
+		if tag.Union != "" {
+			if f.Type != Union {
+				return nil, fmt.Errorf("struc: `union=%s` field `%s` must be an interface", tag.Union, field.Name)
+			}
+			source, ok := t.FieldByName(tag.Union)
+			if !ok {
+				return nil, fmt.Errorf("struc: `union=%s` field does not exist", tag.Union)
+			}
+			if source.Index[0] >= i {
+				return nil, fmt.Errorf("struc: `union=%s` on field `%s` must refer to an earlier field", tag.Union, field.Name)
+			}
+			switch source.Type.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			default:
+				return nil, fmt.Errorf("struc: `union=%s` discriminator must be an integer", tag.Union)
+			}
+			if len(source.Index) != 1 {
+				return nil, fmt.Errorf("struc: `union=%s` on field `%s` must refer to a field of the same struct", tag.Union, field.Name)
+			}
+			f.unionFrom = source.Index
+			if fields[source.Index[0]] != nil {
+				fields[source.Index[0]].unionOf = []int{i}
+			}
+		}
+		if tag.Const != "" {
+			if f.Ptr || f.Type == Struct || f.Type == Union || f.Type == CustomType {
+				return nil, fmt.Errorf("struc: `const=` is not supported on field `%s`", field.Name)
+			}
+			if f.constVal, err = parseConst(tag.Const, field.Type); err != nil {
+				return nil, err
+			}
+			if err = f.checkConstWidth(tag.Const); err != nil {
+				return nil, err
+			}
+		}
+		if tag.Offsetfrom != "" {
+			source, ok := t.FieldByName(tag.Offsetfrom)
+			if !ok {
+				return nil, fmt.Errorf("struc: `offsetfrom=%s` field does not exist", tag.Offsetfrom)
+			}
+			if len(source.Index) != 1 || source.Index[0] >= i || fields[source.Index[0]] == nil {
+				return nil, fmt.Errorf("struc: `offsetfrom=%s` on field `%s` must refer to an earlier field", tag.Offsetfrom, field.Name)
+			}
+			if f.Bits > 0 {
+				return nil, fmt.Errorf("struc: bit-field `%s` cannot be an offset field", field.Name)
+			}
+			src := fields[source.Index[0]]
+			if _, ok := intValue(reflect.New(source.Type).Elem(), 0); !ok || src.offsetOf != nil {
+				return nil, fmt.Errorf("struc: `offsetfrom=%s` must be an integer field used by a single offset field", tag.Offsetfrom)
+			}
+			if src.Type.isVarint() {
+				return nil, fmt.Errorf("struc: `offsetfrom=%s` cannot refer to a varint field", tag.Offsetfrom)
+			}
+			f.offsetFrom = source.Index
+			f.base = baseStart
+			if tag.Base != "" {
+				f.base = tag.Base
+			}
+			src.offsetOf = []int{i}
+		}
+		if (f.Type.isFixed() || f.Type == Binary16 || f.Type == BFloat16) && f.kind != reflect.Float32 && f.kind != reflect.Float64 {
+			return nil, fmt.Errorf("struc: %s field `%s` must be a float, not %s", f.Type, field.Name, f.kind)
+		}
+		if f.Type.isTime() {
+			elem := field.Type
+			for elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Slice || elem.Kind() == reflect.Array {
+				elem = elem.Elem()
+			}
+			if elem != timeType {
+				return nil, fmt.Errorf("struc: %s field `%s` must be a time.Time, not %s", f.Type, field.Name, elem)
+			}
+		}
+		if tag.Tz != "" {
+			if !f.Type.isTime() {
+				return nil, fmt.Errorf("struc: `tz=` is only supported on timestamp fields, not `%s`", field.Name)
+			}
+			if f.loc, err = time.LoadLocation(tag.Tz); err != nil {
+				return nil, fmt.Errorf("struc: invalid `tz=%s` on field `%s`: %s", tag.Tz, field.Name, err)
+			}
+		}
+		if f.Type.isBCD() {
+			switch f.kind {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.String:
+			default:
+				return nil, fmt.Errorf("struc: %s field `%s` must be an integer or string, not %s", f.Type, field.Name, f.kind)
+			}
+		}
+		if tag.Sign {
+			if !f.Type.isBCD() || f.Type&bcdUnpacked != 0 {
+				return nil, fmt.Errorf("struc: `sign` is only supported on packed `bcd` fields, not `%s`", field.Name)
+			}
+			f.Type |= bcdSigned
+		}
+		if tag.Round != "" {
+			if !f.Type.isFixed() {
+				return nil, fmt.Errorf("struc: `round=` is only supported on fixed-point fields, not `%s`", field.Name)
+			}
+			f.round = tag.Round
+		}
+		if f.Type.isVarint() {
+			switch f.kind {
+			case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			default:
+				return nil, fmt.Errorf("struc: %s field `%s` must be an integer, not %s", f.Type, field.Name, f.kind)
+			}
+			if tag.TotalSize || strings.Contains(tag.Sizeof, "..") {
+				// the size would depend on itself
+				return nil, fmt.Errorf("struc: %s field `%s` cannot hold a total size", f.Type, field.Name)
+			}
+		}
+		if tag.TotalSize || strings.Contains(tag.Sizeof, "..") {
+			if err := parseSpan(fields, f, tag, t); err != nil {
+				return nil, err
+			}
+		} else if tag.Sizeof != "" && !identRe.MatchString(tag.Sizeof) {
+			se, target, err := parseSizeExpr(tag.Sizeof, t, true)
+			if err != nil {
+				return nil, err
+			}
+			f.Sizeof = target.index
+			f.sizeExpr = se
+			f.byteSize = tag.ByteSize
+			sizeofMap[target.name] = field.Index
+			sizeofFields[target.name] = f
+		} else if tag.Sizeof != "" {
 			target, ok := t.FieldByName(tag.Sizeof)
 			if !ok {
-				return nil, fmt.Errorf("struc: `sizeof=%s` field does not exist", tag.Sizeof)
+				return nil, &TagError{Struct: t.Name(), Field: field.Name, Token: "sizeof=" + tag.Sizeof,
+					Reason: "no such field in", Suggestion: suggestField(tag.Sizeof, t, "sizeof=")}
+			}
+			switch target.Type.Kind() {
+			case reflect.Slice, reflect.Array, reflect.String:
+			default:
+				return nil, &TagError{Struct: t.Name(), Field: field.Name, Token: "sizeof=" + tag.Sizeof,
+					Reason: "target is not a slice, array or string in"}
 			}
 			f.Sizeof = target.Index
+			f.byteSize = tag.ByteSize
 			sizeofMap[tag.Sizeof] = field.Index
+			sizeofFields[tag.Sizeof] = f
 		}
 		if sizefrom, ok := sizeofMap[field.Name]; ok {
 			f.Sizefrom = sizefrom
+			f.sizeExpr = sizeofFields[field.Name].sizeExpr
+			f.byteSize = sizeofFields[field.Name].byteSize
 		}
-		if tag.Sizefrom != "" {
+		if tag.Sizefrom != "" && !identRe.MatchString(tag.Sizefrom) {
+			se, source, err := parseSizeExpr(tag.Sizefrom, t, false)
+			if err != nil {
+				return nil, err
+			}
+			f.Sizefrom = source.index
+			f.sizeExpr = se
+			f.byteSize = tag.ByteSize
+			// write the inverse back into the length field on Pack when
+			// it is a plain field decoded before this one
+			if len(source.index) == 1 && source.index[0] < i {
+				if src := fields[source.index[0]]; src != nil && src.Sizeof == nil {
+					src.Sizeof = []int{i}
+					src.sizeExpr = se
+					src.byteSize = tag.ByteSize
+				}
+			}
+		} else if tag.Sizefrom != "" {
 			source, ok := t.FieldByName(tag.Sizefrom)
 			if !ok {
-				return nil, fmt.Errorf("struc: `sizefrom=%s` field does not exist", tag.Sizefrom)
+				return nil, &TagError{Struct: t.Name(), Field: field.Name, Token: "sizefrom=" + tag.Sizefrom,
+					Reason: "no such field in", Suggestion: suggestField(tag.Sizefrom, t, "sizefrom=")}
 			}
 			f.Sizefrom = source.Index
+			f.byteSize = tag.ByteSize
+		}
+		if f.byteSize && f.Sizefrom != nil && (f.Array || !f.Slice && f.kind != reflect.String) {
+			return nil, fmt.Errorf("struc: byte size of field `%s` must be tracked on a slice or string", field.Name)
+		}
+		if tag.Rest {
+			if f.Sizefrom != nil || f.Array || (!f.Slice && f.kind != reflect.String) {
+				return nil, fmt.Errorf("struc: `rest` field `%s` must be a slice or string with no length", field.Name)
+			}
+			f.rest = true
+		}
+		if tag.Pad != "" {
+			if f.Type != Pad && !(f.Slice && f.Type == Uint8) && f.kind != reflect.String {
+				return nil, fmt.Errorf("struc: `pad=` is only supported on pad, byte and string fields, not `%s`", field.Name)
+			}
+			if f.padByte, err = parsePadByte(tag.Pad); err != nil {
+				return nil, err
+			}
+			f.hasPad = true
+		}
+		if tag.CString || tag.Trim || tag.Strict {
+			if f.kind != reflect.String || !f.Slice || f.Type != Uint8 {
+				return nil, fmt.Errorf("struc: `cstring`, `trim` and `strict` need a string field with a byte type such as `[16]byte`, not `%s`", field.Name)
+			}
+			f.cstring, f.trim, f.strict = tag.CString, tag.Trim, tag.Strict
+		}
+		if tag.Since > 0 || tag.Before > 0 {
+			if f.Bits > 0 {
+				return nil, fmt.Errorf("struc: bit-field `%s` cannot be version gated", field.Name)
+			}
+			if tag.Before > 0 && tag.Before <= tag.Since {
+				return nil, fmt.Errorf("struc: field `%s` has no versions between `since=%d` and `before=%d`", field.Name, tag.Since, tag.Before)
+			}
+			f.since, f.before = tag.Since, tag.Before
+		}
+		if tag.Version {
+			if _, ok := intValue(reflect.New(field.Type).Elem(), 0); !ok || f.Bits > 0 {
+				return nil, fmt.Errorf("struc: `version` field `%s` must be an integer", field.Name)
+			}
+			f.isVersion = true
+		}
+		if tag.ByteOrder != nil {
+			if f.Bits > 0 || f.Ptr || f.Type == Struct || f.Type == Union || f.Type == CustomType {
+				return nil, fmt.Errorf("struc: `byteorder=` is not supported on field `%s`", field.Name)
+			}
+			if f.byteOrders, err = parseOrderCases(tag.ByteOrder, field.Type); err != nil {
+				return nil, err
+			}
+		}
+		if tag.Align > 0 {
+			f.alignTo = tag.Align
+			f.alignStart = tag.Base == baseStart
+		}
+		if tag.Pstring != "" {
+			if f.Sizefrom != nil || f.Ptr || f.Array || (f.kind != reflect.String && !(f.Slice && f.kind == reflect.Uint8)) {
+				return nil, fmt.Errorf("struc: `pstring=` field `%s` must be a string or byte slice with no other length", field.Name)
+			}
+			if f.prefix, err = parsePrefix(tag.Pstring); err != nil {
+				return nil, err
+			}
 		}
-		if f.Len == -1 && f.Sizefrom == nil {
+		if tag.Until != "" {
+			if f.Sizefrom != nil || f.Array || !f.Slice || f.rest || f.Type == CustomType {
+				return nil, fmt.Errorf("struc: `until=` field `%s` must be a slice with no length", field.Name)
+			}
+			if f.until, err = parseTerminator(tag.Until, tag.KeepTerm, field.Type); err != nil {
+				return nil, err
+			}
+		}
+		if f.Len == -1 && f.Sizefrom == nil && !f.rest && f.until == nil && f.prefix == Invalid {
 			return nil, fmt.Errorf("struc: field `%s` is a slice with no length or sizeof field", field.Name)
 		}
+		if f.Bits > 0 {
+			if err := checkBitField(f); err != nil {
+				return nil, err
+			}
+			unitBits := f.Type.Size() * 8
+			if bitUnit == nil || bitUnit.Type != f.Type || bitUnit.Order != f.Order ||
+				bitUnit.lsbFirst != f.lsbFirst || bitsUsed+f.Bits > unitBits {
+				bitUnit = f
+				bitsUsed = 0
+			}
+			bitUnit.bitGroup = append(bitUnit.bitGroup, i)
+			if f.lsbFirst {
+				f.bitShift = bitsUsed
+			} else {
+				f.bitShift = unitBits - bitsUsed - f.Bits
+			}
+			bitsUsed += f.Bits
+			if f.alignTo > 0 && f.bitGroup == nil {
+				return nil, fmt.Errorf("struc: bit-field `%s` shares its storage unit, so cannot be aligned", field.Name)
+			}
+			if bitRun == nil {
+				bitRun = f
+			}
+			bitRun.bitRun = append(bitRun.bitRun, i)
+		} else {
+			bitUnit, bitRun = nil, nil
+		}
 		// recurse into nested structs
 		// TODO: handle loops (probably by indirecting the []Field and putting pointer in cache)
 		if f.Type == Struct {
@@ -194,16 +679,96 @@ func parseFieldsLocked(v reflect.Value) (Fields, error) {
 					typ = typ.Elem()
 				}
 			}
-			f.Fields, err = parseFieldsLocked(reflect.New(typ))
+			f.Fields, err = parseFieldsLocked(reflect.New(typ), order)
 			if err != nil {
 				return nil, err
 			}
+			for _, nested := range f.Fields {
+				if nested != nil && (nested.alignStart || nested.streamAlign) {
+					f.streamAlign = true
+				}
+			}
 		}
 		fields[i] = f
 	}
+	for _, f := range fields {
+		if f == nil {
+			continue
+		}
+		f.packAlign = packAlign
+		if f.span != nil {
+			if fields[f.span[0]] == nil || fields[f.span[1]] == nil {
+				return nil, fmt.Errorf("struc: `sizeof=` range on field `%s` must start and end on encoded fields", f.Name)
+			}
+			// a range after its size field is bounded by it on Unpack
+			if f.Index < f.span[0] {
+				fields[f.span[0]].spanOf = []int{f.Index}
+			} else {
+				fields[f.span[0]].spanMark = true
+				fields[f.span[1]].spanMark = true
+			}
+			for _, g := range fields[f.span[0] : f.span[1]+1] {
+				if g != nil && g.offsetFrom != nil {
+					return nil, fmt.Errorf("struc: `sizeof=` range on field `%s` cannot cover offset field `%s`", f.Name, g.Name)
+				}
+			}
+		}
+	}
+	// flags on earlier fields are only complete once every field is parsed
+	for _, f := range fields {
+		if f != nil {
+			f.plain = f.isPlain()
+		}
+	}
 	return fields, nil
 }
 
+// parsePadByte parses the byte from a `pad=` tag, either a number such as
+// `pad=0xFF` or a quoted character such as `pad=" "`.
+func parsePadByte(lit string) (byte, error) {
+	if strings.HasPrefix(lit, `"`) {
+		s, err := strconv.Unquote(lit)
+		if err != nil || len(s) != 1 {
+			return 0, fmt.Errorf("struc: invalid `pad=%s`, must be a single byte", lit)
+		}
+		return s[0], nil
+	}
+	n, err := strconv.ParseUint(lit, 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("struc: invalid `pad=%s`, must be a single byte", lit)
+	}
+	return byte(n), nil
+}
+
+// parseSpan sets up a `totalsize` or `sizeof=A..B` field f, which holds the
+// encoded size of its struct or of the fields A through B.
+func parseSpan(fields Fields, f *Field, tag *strucTag, t reflect.Type) error {
+	if _, ok := intValue(reflect.New(t.Field(f.Index).Type).Elem(), 0); !ok || f.Bits > 0 {
+		return fmt.Errorf("struc: size field `%s` must be a plain integer", f.Name)
+	}
+	if tag.TotalSize {
+		if tag.Sizeof != "" {
+			return fmt.Errorf("struc: field `%s` cannot use both `totalsize` and `sizeof=`", f.Name)
+		}
+		f.totalSize = true
+		return nil
+	}
+	names := strings.SplitN(tag.Sizeof, "..", 2)
+	var span []int
+	for _, name := range names {
+		sf, ok := t.FieldByName(name)
+		if !ok || len(sf.Index) != 1 {
+			return fmt.Errorf("struc: `sizeof=%s` field `%s` does not exist", tag.Sizeof, name)
+		}
+		span = append(span, sf.Index[0])
+	}
+	if span[0] > span[1] {
+		return fmt.Errorf("struc: `sizeof=%s` range is backwards", tag.Sizeof)
+	}
+	f.span = span
+	return nil
+}
+
 var fieldCache = make(map[reflect.Type]Fields)
 var fieldCacheLock sync.RWMutex
 var parseLock sync.Mutex
@@ -239,7 +804,7 @@ func parseFields(v reflect.Value) (Fields, error) {
 	}
 
 	// no luck, time to parse and fill the cache ourselves
-	fields, err := parseFieldsLocked(v)
+	fields, err := parseFieldsLocked(v, nil)
 	if err != nil {
 		return nil, err
 	}
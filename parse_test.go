@@ -60,3 +60,95 @@ func TestNestedParseError(t *testing.T) {
 		t.Fatal("failed to error on bad nested struct")
 	}
 }
+
+func TestTagErrors(t *testing.T) {
+	type unknownType struct {
+		Count int `struc:"unit32,big"`
+	}
+	type unknownKey struct {
+		Size int `struc:"int8,sizof=Data"`
+		Data []byte
+	}
+	type conflictOrder struct {
+		Count int `struc:"int32,big,little"`
+	}
+	type repeatedType struct {
+		Count int `struc:"int32,int16"`
+	}
+	type conflictSizeof struct {
+		Size int `struc:"int8,sizeof=Data,bytesizeof=Data"`
+		Data []byte
+	}
+	type sizeofInt struct {
+		Size  int `struc:"int8,sizeof=Count"`
+		Count int
+	}
+	type missingTarget struct {
+		Size int `struc:"int8,sizeof=Dat"`
+		Data []byte
+	}
+	type skippedTypo struct {
+		Count int `struc:"uint33,skip"`
+	}
+	tests := []struct {
+		data interface{}
+		want string
+	}{
+		{&unknownType{}, "struc: unknownType.Count: unknown type `unit32`, did you mean `uint32`?"},
+		{&unknownKey{}, "struc: unknownKey.Size: unknown tag key `sizof=Data`, did you mean `sizeof=Data`?"},
+		{&conflictOrder{}, "struc: conflictOrder.Count: `big` conflicts with `little`"},
+		{&repeatedType{}, "struc: repeatedType.Count: `int32` conflicts with `int16`"},
+		{&conflictSizeof{}, "struc: conflictSizeof.Size: `sizeof=Data` conflicts with `bytesizeof=Data`"},
+		{&sizeofInt{}, "struc: sizeofInt.Size: target is not a slice, array or string in `sizeof=Count`"},
+		{&missingTarget{}, "struc: missingTarget.Size: no such field in `sizeof=Dat`, did you mean `sizeof=Data`?"},
+		{&skippedTypo{}, "struc: skippedTypo.Count: unknown type `uint33`, did you mean `uint32`?"},
+	}
+	for _, test := range tests {
+		err := parseTest(test.data)
+		if _, ok := err.(*TagError); !ok {
+			t.Errorf("%T: got %v, want a *TagError", test.data, err)
+		} else if err.Error() != test.want {
+			t.Errorf("%T: got %q, want %q", test.data, err, test.want)
+		}
+	}
+}
+
+func TestTagValid(t *testing.T) {
+	type valid struct {
+		Size  int    `struc:"uint8,sizeof=Data,big"`
+		Data  []byte `struc:"[]byte"`
+		Flags int    `struc:"uint8,bits=4,lsbfirst"`
+		Rest  []byte `struc:"[4]byte,pad=\",\""`
+	}
+	if err := parseTest(&valid{}); err != nil {
+		t.Fatal(err)
+	}
+	// struct elements may be named by their Go type
+	type rec struct {
+		Type uint8
+	}
+	type structSlices struct {
+		Count   int    `struc:"uint8,sizeof=Recs"`
+		Recs    []rec  `struc:"[]rec"`
+		Pair    [2]rec `struc:"[2]rec"`
+		Entries []*rec `struc:"[]rec,until=zero"`
+		Rest    []rec  `struc:"[]rec,rest"`
+	}
+	if err := parseTest(&structSlices{}); err != nil {
+		t.Fatal(err)
+	}
+	in := &structSlices{Recs: []rec{{1}}, Pair: [2]rec{{2}, {3}}, Entries: []*rec{{4}}, Rest: []rec{{5}}}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{1, 1, 2, 3, 4, 0, 5}; !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	type wrongElem struct {
+		Recs []rec `struc:"[]Rec"`
+	}
+	if err := parseTest(&wrongElem{}); err == nil {
+		t.Fatal("accepted a type naming neither a struc type nor the element type")
+	}
+}
@@ -0,0 +1,69 @@
+package struc
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// parsePrefix parses the length prefix type from a `pstring=uint16` tag.
+func parsePrefix(name string) (Type, error) {
+	switch typ := typeLookup[name]; typ {
+	case Int8, Uint8, Int16, Uint16, Int32, Uint32, Int64, Uint64:
+		return typ, nil
+	}
+	return Invalid, fmt.Errorf("struc: invalid `pstring=%s`, must be an integer type", name)
+}
+
+// prefixMax returns the longest length a prefix of type typ can hold.
+func prefixMax(typ Type) uint64 {
+	bits := uint(typ.Size() * 8)
+	switch typ {
+	case Int8, Int16, Int32, Int64:
+		bits--
+	}
+	return uint64(1)<<bits - 1
+}
+
+// packPrefixed packs the `pstring=` field val after its length prefix.
+func (f *Field) packPrefixed(buf []byte, val reflect.Value, options *Options) (int, error) {
+	var data []byte
+	if val.Kind() == reflect.String {
+		data = []byte(val.String())
+	} else {
+		data = val.Bytes()
+	}
+	if uint64(len(data)) > prefixMax(f.prefix) {
+		return 0, fmt.Errorf("struc: field %s holds %d bytes, too long for its %s length prefix", f.Name, len(data), f.prefix)
+	}
+	putUint(buf, f.prefix, f.order(options), uint64(len(data)))
+	n := f.prefix.Size()
+	return n + copy(buf[n:], data), nil
+}
+
+// unpackPrefixed reads the length prefix of the `pstring=` field and the
+// string or bytes following it. The data is read as it arrives rather than
+// allocated up front, since the prefix comes from the input.
+func (f *Field) unpackPrefixed(r *reader, val reflect.Value, options *Options) error {
+	buf := r.tmp[:f.prefix.Size()]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	n := getUint(buf, f.prefix, f.order(options))
+	if n > prefixMax(f.prefix) {
+		return fmt.Errorf("struc: field %s has negative length prefix", f.Name)
+	} else if n > math.MaxInt64 {
+		return fmt.Errorf("struc: field %s has length prefix %d, which is too long", f.Name, n)
+	}
+	data, err := readBytes(r, int64(n))
+	if err != nil {
+		return err
+	}
+	if val.Kind() == reflect.String {
+		val.SetString(string(data))
+	} else {
+		val.SetBytes(data)
+	}
+	return nil
+}
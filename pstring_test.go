@@ -0,0 +1,71 @@
+package struc
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+type pstringStruct struct {
+	Name  string `struc:"pstring=uint16,big"`
+	Data  []byte `struc:"pstring=uint8"`
+	Label string `struc:"pstring=uint32"`
+}
+
+func TestPstring(t *testing.T) {
+	in := &pstringStruct{Name: "abc", Data: []byte{1, 2}}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 3, 'a', 'b', 'c', 2, 1, 2, 0, 0, 0, 0}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	if size, _ := Sizeof(in); size != len(want) {
+		t.Fatalf("bad size: %d", size)
+	}
+	out := &pstringStruct{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %#v\nwant: %#v", out, in)
+	}
+}
+
+func TestPstringErrors(t *testing.T) {
+	if err := Pack(&bytes.Buffer{}, &pstringStruct{Data: make([]byte, 256)}); err == nil {
+		t.Fatal("failed to reject data too long for its prefix")
+	}
+	err := Unpack(bytes.NewReader([]byte{0, 3, 'a'}), &pstringStruct{})
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	// huge prefixes on short input fail without allocating or panicking
+	type wide struct {
+		A []byte `struc:"pstring=uint32,big"`
+		B []byte `struc:"pstring=uint64,big"`
+	}
+	for _, in := range [][]byte{
+		{0xff, 0xff, 0xff, 0xff, 'a'},
+		{0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 'a'},
+		{0, 0, 0, 0, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 'a'},
+	} {
+		if err := Unpack(bytes.NewReader(in), &wide{}); err == nil {
+			t.Fatalf("%#v: unpacked without error", in)
+		}
+	}
+	type badPrefix struct {
+		Name string `struc:"pstring=float32"`
+	}
+	type badField struct {
+		Vals []uint16 `struc:"pstring=uint8"`
+	}
+	for _, v := range []interface{}{&badPrefix{}, &badField{}} {
+		if err := Pack(&bytes.Buffer{}, v); err == nil {
+			t.Errorf("%T: failed to reject bad pstring= tag", v)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package struc
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// reader wraps the io.Reader passed to Unpack and tracks the stream position,
+// so fields can be located relative to the start of the stream.
+type reader struct {
+	r      io.Reader
+	src    io.Reader // the reader originally passed to Unpack
+	origin int64     // position of src when unpacking started
+	pos    int64     // bytes consumed since unpacking started
+	tmp    [8]byte   // scratch space for reading small fields
+}
+
+func newReader(r io.Reader) *reader {
+	if pr, ok := r.(*reader); ok {
+		return pr
+	}
+	pr := &reader{r: r, src: r}
+	if s, ok := r.(io.Seeker); ok {
+		if off, err := s.Seek(0, io.SeekCurrent); err == nil {
+			pr.origin = off
+		}
+	}
+	return pr
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+// skip discards the next n bytes of the stream.
+func (r *reader) skip(n int) error {
+	if n <= 0 {
+		return nil
+	}
+	_, err := io.CopyN(ioutil.Discard, r, int64(n))
+	return err
+}
+
+// limit returns a reader for the next n bytes of r.
+func (r *reader) limit(n int64) *reader {
+	return &reader{r: io.LimitReader(r, n), src: r.src, origin: r.origin, pos: r.pos}
+}
+
+// at returns a reader positioned at pos, relative to the start of the stream,
+// and a function restoring the underlying stream once reading is done. The
+// stream must implement io.ReaderAt or io.ReadSeeker.
+func (r *reader) at(pos int64) (*reader, func() error, error) {
+	if pos < 0 {
+		return nil, nil, fmt.Errorf("struc: negative stream offset %d", pos)
+	}
+	if ra, ok := r.src.(io.ReaderAt); ok {
+		sub := &reader{
+			r:      io.NewSectionReader(ra, r.origin+pos, 1<<62),
+			src:    r.src,
+			origin: r.origin,
+			pos:    pos,
+		}
+		return sub, func() error { return nil }, nil
+	}
+	s, ok := r.src.(io.Seeker)
+	if !ok {
+		return nil, nil, fmt.Errorf("struc: offset fields require an io.ReaderAt or io.ReadSeeker, got %T", r.src)
+	}
+	resume := r.origin + r.pos
+	if _, err := s.Seek(r.origin+pos, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	sub := &reader{r: r.src, src: r.src, origin: r.origin, pos: pos}
+	restore := func() error {
+		_, err := s.Seek(resume, io.SeekStart)
+		return err
+	}
+	return sub, restore, nil
+}
@@ -0,0 +1,162 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type offsetSection struct {
+	Type uint16 `struc:"big"`
+	Size uint16 `struc:"big"`
+}
+
+type offsetHeader struct {
+	Magic    [2]byte
+	Count    int `struc:"uint8,sizeof=Sections"`
+	SecOff   Off_t
+	Sections []offsetSection `struc:"offsetfrom=SecOff"`
+	NameOff  uint8
+	NameLen  int    `struc:"uint8,sizeof=Name"`
+	Name     string `struc:"offsetfrom=NameOff,base=struct"`
+	Flags    uint8
+}
+
+var offsetReference = &offsetHeader{
+	Magic:    [2]byte{'E', 'X'},
+	Count:    2,
+	SecOff:   10,
+	Sections: []offsetSection{{1, 0x10}, {2, 0x20}},
+	NameOff:  18,
+	NameLen:  4,
+	Name:     "text",
+	Flags:    7,
+}
+
+var offsetReferenceBytes = []byte{
+	'E', 'X', 2, // Magic, Count
+	10, 0, 0, 0, // SecOff
+	18, 4, // NameOff, NameLen
+	7,                            // Flags
+	0, 1, 0, 0x10, 0, 2, 0, 0x20, // Sections
+	't', 'e', 'x', 't', // Name
+}
+
+func TestOffsetPack(t *testing.T) {
+	in := *offsetReference
+	in.SecOff, in.NameOff = 0, 0
+	var buf bytes.Buffer
+	if err := Pack(&buf, &in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), offsetReferenceBytes) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), offsetReferenceBytes)
+	}
+	if size, _ := Sizeof(&in); size != len(offsetReferenceBytes) {
+		t.Fatalf("sizeof failed; expected %d, got %d", len(offsetReferenceBytes), size)
+	}
+}
+
+func TestOffsetUnpack(t *testing.T) {
+	r := bytes.NewReader(offsetReferenceBytes)
+	out := &offsetHeader{}
+	if err := Unpack(r, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, offsetReference) {
+		t.Fatalf("got: %#v\nwant: %#v", out, offsetReference)
+	}
+	// the stream is left at the end of the fixed part
+	if r.Len() != 12 {
+		t.Fatalf("unexpected stream position, %d bytes left", r.Len())
+	}
+}
+
+// readSeeker hides io.ReaderAt so the seeking code path is used
+type readSeeker struct {
+	r *bytes.Reader
+}
+
+func (r readSeeker) Read(p []byte) (int, error) { return r.r.Read(p) }
+func (r readSeeker) Seek(off int64, whence int) (int64, error) {
+	return r.r.Seek(off, whence)
+}
+
+type offsetNested struct {
+	Prefix uint8
+	Header offsetHeader
+}
+
+func TestOffsetNested(t *testing.T) {
+	in := &offsetNested{Prefix: 0xff, Header: *offsetReference}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	// base=start offsets count from the start of the stream, base=struct from the header
+	in.Header.SecOff = 11
+	if got := buf.Bytes()[4]; got != 11 {
+		t.Fatalf("wrong SecOff: %d", got)
+	}
+	// skip a byte of garbage so the stream doesn't start at position 0
+	r := bytes.NewReader(append([]byte{0xaa}, buf.Bytes()...))
+	r.ReadByte()
+	out := &offsetNested{}
+	if err := Unpack(readSeeker{r}, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("got: %#v\nwant: %#v", out, in)
+	}
+	// the stream is left after the offset data Pack laid out in Header
+	if r.Len() != 0 {
+		t.Fatalf("unexpected stream position, %d bytes left", r.Len())
+	}
+}
+
+type offsetInner struct {
+	Off  uint8
+	Data [3]byte `struc:"offsetfrom=Off,base=struct"`
+}
+
+type offsetOuter struct {
+	In    offsetInner
+	After uint8
+}
+
+func TestOffsetNestedFollowed(t *testing.T) {
+	in := &offsetOuter{In: offsetInner{Data: [3]byte{1, 2, 3}}, After: 9}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{1, 1, 2, 3, 9}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	out := &offsetOuter{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	in.In.Off = 1
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("got: %#v\nwant: %#v", out, in)
+	}
+}
+
+func TestOffsetRequiresSeek(t *testing.T) {
+	if err := Unpack(bytes.NewBuffer(offsetReferenceBytes), &offsetHeader{}); err == nil {
+		t.Fatal("failed to error on unseekable reader")
+	}
+}
+
+type offsetForward struct {
+	Data []byte `struc:"[4]byte,offsetfrom=Off"`
+	Off  uint32
+}
+
+func TestOffsetForwardReference(t *testing.T) {
+	if err := parseTest(&offsetForward{}); err == nil {
+		t.Fatal("failed to error on offset field referring to a later field")
+	}
+}
@@ -5,12 +5,33 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"time"
 )
 
 type Options struct {
 	ByteAlign int
 	PtrSize   int
 	Order     binary.ByteOrder
+	Layout    Layout
+	// PadByte fills pad fields and the unused end of fixed-width strings
+	// and byte slices, unless the field has a `pad=` tag.
+	PadByte byte
+	// CheckPad makes Unpack verify that pad fields hold their pad byte.
+	CheckPad bool
+	// Version is the format version checked by `since=` and `before=`
+	// fields, unless a `version` field in the struct sets it.
+	Version int
+	// Location holds the times unpacked from timestamp fields, and the wall
+	// clock of `dosdatetime` and `hfs` fields, unless a `tz=` tag sets it.
+	// The default is UTC.
+	Location *time.Location
+
+	// capacity of the buffer passed to the outermost Fields.Pack, used to
+	// find the stream position of nested structs
+	bufCap int
+	// stream position of the struct being sized, for fields aligned to the
+	// stream start
+	streamPos int
 }
 
 func (o *Options) Validate() error {
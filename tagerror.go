@@ -0,0 +1,186 @@
+package struc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// TagError reports an invalid struc tag, naming the struct, the field and
+// the offending token.
+type TagError struct {
+	Struct     string
+	Field      string
+	Token      string
+	Reason     string
+	Suggestion string // a close match for Token, if any
+}
+
+func (e *TagError) Error() string {
+	name := e.Field
+	if e.Struct != "" {
+		name = e.Struct + "." + name
+	}
+	msg := fmt.Sprintf("struc: %s: %s `%s`", name, e.Reason, e.Token)
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(", did you mean `%s`?", e.Suggestion)
+	}
+	return msg
+}
+
+// tagKeys are the tag tokens taking a value, as in `key=value`.
+var tagKeys = []string{
+	"align", "base", "before", "bits", "byteorder", "bytesizefrom", "bytesizeof",
+	"const", "if", "offsetfrom", "pad", "pstring", "round", "since", "sizefrom",
+	"sizeof", "tz", "union", "until",
+}
+
+// tagFlags are the tag tokens standing alone, other than types.
+var tagFlags = []string{
+	"big", "cstring", "keepterm", "little", "lsbfirst", "msbfirst", "rest",
+	"sign", "skip", "strict", "totalsize", "trim", "version",
+}
+
+// tagGroups maps tag tokens to the group of tokens they conflict with.
+var tagGroups = map[string]string{
+	"big":          "order",
+	"little":       "order",
+	"msbfirst":     "bitorder",
+	"lsbfirst":     "bitorder",
+	"bytesizeof":   "sizeof",
+	"bytesizefrom": "sizefrom",
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest returns the candidate closest to s, or "" if none is close enough
+// to be a likely typo.
+func suggest(s string, candidates []string) string {
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted)
+	best, bestDist := "", 3
+	for _, c := range sorted {
+		if d := editDistance(s, c); d < bestDist && d < len(c) {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the edit distance between a and b, counting a swap
+// of adjacent characters as one edit, as in `unit32` for `uint32`.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// typeNameList returns the names of the types usable in struc tags.
+func typeNameList() []string {
+	names := make([]string, 0, len(typeLookup))
+	for name := range typeLookup {
+		names = append(names, name)
+	}
+	return names
+}
+
+// suggestField suggests the field of the struct type t that the tag token
+// key+name may have meant.
+func suggestField(name string, t reflect.Type, key string) string {
+	names := make([]string, t.NumField())
+	for i := range names {
+		names[i] = t.Field(i).Name
+	}
+	if sug := suggest(name, names); sug != "" {
+		return key + sug
+	}
+	return ""
+}
+
+// isElemName reports whether name is the Go element type of a field of type
+// typ, as in `[]Entry` for a field of type []Entry. Such types are not struc
+// types, but name the element type the field already has.
+func isElemName(name string, typ reflect.Type) bool {
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = typ.Elem()
+	}
+	return name != "" && (name == typ.Name() || name == typ.String())
+}
+
+// checkTagToken validates the struc tag token s of a field of type typ,
+// which is a `key=value` pair, a flag or a type. seen maps each conflict
+// group to the first token in it, and is updated.
+func checkTagToken(s string, seen map[string]string, typ reflect.Type) *TagError {
+	key, group := s, ""
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		key = s[:i]
+		if !contains(tagKeys, key) {
+			err := &TagError{Token: s, Reason: "unknown tag key"}
+			if sug := suggest(key, tagKeys); sug != "" {
+				err.Suggestion = sug + s[i:]
+			}
+			return err
+		}
+	} else if !contains(tagFlags, s) {
+		prefix := typeLenRe.FindString(s)
+		if _, ok := lookupType(s[len(prefix):]); !ok && !isElemName(s[len(prefix):], typ) {
+			err := &TagError{Token: s, Reason: "unknown type"}
+			if sug := suggest(s[len(prefix):], typeNameList()); sug != "" {
+				err.Suggestion = prefix + sug
+			} else if sug := suggest(s, tagFlags); sug != "" {
+				err.Suggestion = sug
+			}
+			return err
+		}
+		group = "type"
+	}
+	if group == "" {
+		if group = tagGroups[key]; group == "" {
+			group = key
+		}
+	}
+	if prev, ok := seen[group]; ok {
+		if prev == s {
+			return &TagError{Token: s, Reason: "repeated tag"}
+		}
+		return &TagError{Token: s, Reason: fmt.Sprintf("`%s` conflicts with", prev)}
+	}
+	seen[group] = s
+	return nil
+}
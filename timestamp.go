@@ -0,0 +1,143 @@
+package struc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// seconds from the epochs of the timestamp types to the Unix epoch
+const (
+	ntpEpoch      = 2208988800  // 1900-01-01
+	fileTimeEpoch = 11644473600 // 1601-01-01
+	hfsEpoch      = 2082844800  // 1904-01-01
+)
+
+func (t Type) isTime() bool {
+	switch t {
+	case Unix32, Unix64, UnixMs64, UnixNs64, NTP64, FileTime, DOSDateTime, HFS:
+		return true
+	}
+	return false
+}
+
+// location returns the location of times unpacked from f, and of the wall
+// clock stored by `dosdatetime` and `hfs` fields.
+func (f *Field) location(options *Options) *time.Location {
+	if f.loc != nil {
+		return f.loc
+	} else if options.Location != nil {
+		return options.Location
+	}
+	return time.UTC
+}
+
+// wallSeconds returns the wall clock of t in loc as seconds since the Unix
+// epoch, for formats that store local time.
+func wallSeconds(t time.Time, loc *time.Location) int64 {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC).Unix()
+}
+
+// packTime packs the time.Time val into buf as the timestamp type typ,
+// returning an error if the type cannot represent it. Times are truncated to
+// the resolution of the type.
+func (f *Field) packTime(buf []byte, val reflect.Value, typ Type, order binary.ByteOrder, options *Options) (int, error) {
+	t := val.Interface().(time.Time)
+	s, ns := t.Unix(), int64(t.Nanosecond())
+	var n uint64
+	ok := true
+	switch typ {
+	case Unix32:
+		n, ok = uint64(s), s >= 0 && s <= math.MaxUint32
+	case Unix64:
+		n = uint64(s)
+	case UnixMs64:
+		// the sum wraps negative when it overflows
+		ms := s*1000 + ns/1e6
+		n, ok = uint64(ms), s >= math.MinInt64/1000 && s <= math.MaxInt64/1000 && (ms >= 0 || s < 0)
+	case UnixNs64:
+		nano := s*1e9 + ns
+		n, ok = uint64(nano), s >= math.MinInt64/1000000000 && s <= math.MaxInt64/1000000000 && (nano >= 0 || s < 0)
+	case NTP64:
+		// the fraction counts units of 2^-32 seconds, rounded to nearest
+		frac := (uint64(ns)<<32 + 5e8) / 1e9
+		if frac == 1<<32 {
+			s, frac = s+1, 0
+		}
+		s += ntpEpoch
+		n, ok = uint64(s)<<32|frac, s >= 0 && s <= math.MaxUint32
+	case FileTime:
+		s += fileTimeEpoch
+		n, ok = uint64(s)*1e7+uint64(ns/100), s >= 0 && s < math.MaxUint64/10000000
+	case DOSDateTime:
+		if t.IsZero() {
+			// a zero time packs as zero, which tools write for no date
+			break
+		}
+		w := t.In(f.location(options))
+		date := (w.Year()-1980)<<9 | int(w.Month())<<5 | w.Day()
+		clock := w.Hour()<<11 | w.Minute()<<5 | w.Second()/2
+		n, ok = uint64(date)<<16|uint64(clock), w.Year() >= 1980 && w.Year() <= 2107
+	case HFS:
+		s = wallSeconds(t, f.location(options)) + hfsEpoch
+		n, ok = uint64(s), s >= 0 && s <= math.MaxUint32
+	}
+	if !ok {
+		return 0, fmt.Errorf("struc: time %s of field %s is out of range for %s", t, f.Name, typ)
+	}
+	if typ.Size() == 4 {
+		order.PutUint32(buf, uint32(n))
+	} else {
+		order.PutUint64(buf, n)
+	}
+	return typ.Size(), nil
+}
+
+// unpackTime unpacks the timestamp type typ from buf into the time.Time val.
+func (f *Field) unpackTime(buf []byte, val reflect.Value, typ Type, order binary.ByteOrder, options *Options) error {
+	var n uint64
+	if typ.Size() == 4 {
+		n = uint64(order.Uint32(buf))
+	} else {
+		n = order.Uint64(buf)
+	}
+	loc := f.location(options)
+	var t time.Time
+	switch typ {
+	case Unix32, Unix64:
+		t = time.Unix(int64(n), 0)
+	case UnixMs64:
+		t = time.Unix(int64(n)/1e3, int64(n)%1e3*1e6)
+	case UnixNs64:
+		t = time.Unix(0, int64(n))
+	case NTP64:
+		t = time.Unix(int64(n>>32)-ntpEpoch, int64((n&(1<<32-1)*1e9+1<<31)>>32))
+	case FileTime:
+		t = time.Unix(int64(n/1e7)-fileTimeEpoch, int64(n%1e7)*100)
+	case DOSDateTime:
+		if n == 0 {
+			break
+		}
+		date, clock := int(n>>16), int(n&0xffff)
+		year, month, day := 1980+date>>9, date>>5&0xf, date&0x1f
+		hour, min, sec := clock>>11, clock>>5&0x3f, clock&0x1f*2
+		t = time.Date(year, time.Month(month), day, hour, min, sec, 0, loc)
+		// time.Date normalizes out of range values, such as February 30
+		if int(t.Month()) != month || t.Day() != day || t.Hour() != hour || t.Minute() != min || t.Second() != sec {
+			return fmt.Errorf("struc: field %s holds invalid DOS date and time %#08x", f.Name, n)
+		}
+	case HFS:
+		// build the wall clock from days, which fit in an int on any platform
+		t = time.Date(1904, 1, 1+int(n/86400), 0, 0, int(n%86400), 0, loc)
+	}
+	if !t.IsZero() {
+		t = t.In(loc)
+	}
+	val.Set(reflect.ValueOf(t))
+	return nil
+}
@@ -0,0 +1,218 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type timestamps struct {
+	_        BigEndian
+	Unix32   time.Time `struc:"unix32"`
+	Unix64   time.Time `struc:"unix64"`
+	UnixMs64 time.Time `struc:"unixms64"`
+	UnixNs64 time.Time `struc:"unixns64"`
+	NTP64    time.Time `struc:"ntp64"`
+	FileTime time.Time `struc:"filetime"`
+	DOS      time.Time `struc:"dosdatetime"`
+	HFS      time.Time `struc:"hfs"`
+}
+
+func TestTimestampEncodings(t *testing.T) {
+	in := &timestamps{
+		Unix32:   time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Unix64:   time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC),
+		UnixMs64: time.Unix(1, 234e6).UTC(),
+		UnixNs64: time.Unix(0, -1).UTC(),
+		NTP64:    time.Unix(0, 5e8).UTC(),
+		FileTime: time.Unix(0, 0).UTC(),
+		DOS:      time.Date(2021, 6, 15, 13, 45, 30, 0, time.UTC),
+		HFS:      time.Unix(0, 0).UTC(),
+	}
+	want := []byte{
+		0x38, 0x6d, 0x43, 0x80,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0, 0, 0, 0, 0, 0, 0x04, 0xd2,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x83, 0xaa, 0x7e, 0x80, 0x80, 0, 0, 0,
+		0x01, 0x9d, 0xb1, 0xde, 0xd5, 0x3e, 0x80, 0x00,
+		0x52, 0xcf, 0x6d, 0xaf,
+		0x7c, 0x25, 0xb0, 0x80,
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	if size, _ := Sizeof(in); size != len(want) {
+		t.Fatalf("bad size %d, want %d", size, len(want))
+	}
+	out := &timestamps{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %+v\nwant: %+v", out, in)
+	}
+}
+
+func TestTimestampResolution(t *testing.T) {
+	now := time.Date(2024, 2, 29, 23, 59, 59, 123456789, time.UTC)
+	in := &timestamps{Unix32: now, Unix64: now, UnixMs64: now, UnixNs64: now, NTP64: now, FileTime: now, DOS: now, HFS: now}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	out := &timestamps{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name      string
+		got, want time.Time
+	}{
+		{"unix32", out.Unix32, now.Truncate(time.Second)},
+		{"unix64", out.Unix64, now.Truncate(time.Second)},
+		{"unixms64", out.UnixMs64, now.Truncate(time.Millisecond)},
+		{"unixns64", out.UnixNs64, now},
+		{"filetime", out.FileTime, now.Truncate(100 * time.Nanosecond)},
+		{"dosdatetime", out.DOS, now.Truncate(2 * time.Second)},
+		{"hfs", out.HFS, now.Truncate(time.Second)},
+	} {
+		if !test.got.Equal(test.want) {
+			t.Errorf("%s: got %s, want %s", test.name, test.got, test.want)
+		}
+	}
+	// 2^-32 seconds is finer than a nanosecond, so NTP round-trips exactly
+	if !out.NTP64.Equal(now) {
+		t.Errorf("ntp64: got %s, want %s", out.NTP64, now)
+	}
+}
+
+type timestampZone struct {
+	Local time.Time `struc:"dosdatetime"`
+	HFS   time.Time `struc:"hfs,big,tz=UTC"`
+	Unix  time.Time `struc:"unix32"`
+}
+
+func TestTimestampLocation(t *testing.T) {
+	// a fixed zone needs no tzdata on the host
+	jst := time.FixedZone("JST", 9*60*60)
+	// 2000-01-01 00:00 in JST
+	epoch := time.Date(1999, 12, 31, 15, 0, 0, 0, time.UTC)
+	in := &timestampZone{epoch, epoch.In(jst), epoch}
+	options := &Options{Location: jst}
+	var buf bytes.Buffer
+	if err := PackWithOptions(&buf, in, options); err != nil {
+		t.Fatal(err)
+	}
+	// the tz= tag overrides Options.Location, so the HFS field stores UTC
+	// wall clock regardless of the time's location
+	hfs := buf.Bytes()[4:8]
+	if want := []byte{0xb4, 0x92, 0x75, 0x70}; !bytes.Equal(hfs, want) {
+		t.Fatalf("hfs: got %#v, want %#v", hfs, want)
+	}
+	out := &timestampZone{}
+	if err := UnpackWithOptions(bytes.NewReader(buf.Bytes()), out, options); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		got time.Time
+		loc *time.Location
+	}{
+		{out.Local, jst},
+		{out.HFS, time.UTC},
+		{out.Unix, jst},
+	} {
+		if !test.got.Equal(epoch) || test.got.Location() != test.loc {
+			t.Errorf("got %s, want %s", test.got, epoch.In(test.loc))
+		}
+	}
+	// without a location, the DOS wall clock is read as UTC
+	out = &timestampZone{}
+	if err := Unpack(bytes.NewReader(buf.Bytes()), out); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC); !out.Local.Equal(want) {
+		t.Errorf("got %s, want %s", out.Local, want)
+	}
+}
+
+type timestampSlice struct {
+	Count int         `struc:"uint8,sizeof=Times"`
+	Times []time.Time `struc:"[]unix32,little"`
+	Zero  time.Time   `struc:"dosdatetime"`
+}
+
+func TestTimestampSlice(t *testing.T) {
+	in := &timestampSlice{Times: []time.Time{time.Unix(1, 0).UTC(), time.Unix(0x01020304, 0).UTC()}}
+	want := []byte{2, 1, 0, 0, 0, 4, 3, 2, 1, 0, 0, 0, 0}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	out := &timestampSlice{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	in.Count = 2
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %+v\nwant: %+v", out, in)
+	}
+}
+
+func TestTimestampErrors(t *testing.T) {
+	type unix32 struct {
+		T time.Time `struc:"unix32"`
+	}
+	type nano struct {
+		T time.Time `struc:"unixns64"`
+	}
+	type dos struct {
+		_ BigEndian
+		T time.Time `struc:"dosdatetime"`
+	}
+	for _, data := range []interface{}{
+		&unix32{time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC)},
+		&unix32{time.Date(2106, 2, 8, 0, 0, 0, 0, time.UTC)},
+		&nano{time.Date(2263, 1, 1, 0, 0, 0, 0, time.UTC)},
+		&dos{T: time.Date(1979, 12, 31, 0, 0, 0, 0, time.UTC)},
+	} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, data); err == nil {
+			t.Fatalf("%+v: packed without error", data)
+		}
+	}
+	for _, in := range [][]byte{
+		// month 13
+		{0x53, 0xaf, 0, 0},
+		// February 30
+		{0x52, 0x5e, 0, 0},
+		// 24:00
+		{0x52, 0xcf, 0xc0, 0},
+	} {
+		if err := Unpack(bytes.NewReader(in), &dos{}); err == nil {
+			t.Fatalf("%#v: unpacked without error", in)
+		}
+	}
+	type notTime struct {
+		T int64 `struc:"unix64"`
+	}
+	type tzNotTime struct {
+		T int64 `struc:"int64,tz=UTC"`
+	}
+	type badTz struct {
+		T time.Time `struc:"unix64,tz=Nowhere/Special"`
+	}
+	for _, data := range []interface{}{&notTime{}, &tzNotTime{}, &badTz{}} {
+		if err := parseTest(data); err == nil {
+			t.Fatalf("%T: parsed without error", data)
+		}
+	}
+}
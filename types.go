@@ -29,6 +29,35 @@ const (
 	SizeType
 	OffType
 	CustomType
+	Union
+
+	// LEB128 varints, whose size depends on their value
+	Uvarint
+	Varint // zigzag encoded, as in protobuf sint64
+	Sleb128
+
+	// integers of odd byte widths
+	Int24
+	Uint24
+	Int40
+	Uint40
+	Int48
+	Uint48
+	Int56
+	Uint56
+
+	Binary16 // IEEE 754 half precision, the float16 tag type
+	BFloat16 // the top half of a float32
+
+	// timestamps held in time.Time fields
+	Unix32      // unsigned seconds since 1970
+	Unix64      // seconds since 1970
+	UnixMs64    // milliseconds since 1970
+	UnixNs64    // nanoseconds since 1970
+	NTP64       // seconds since 1900 and a 32-bit fraction
+	FileTime    // Windows FILETIME, 100ns intervals since 1601
+	DOSDateTime // MS-DOS date and time, as in ZIP headers
+	HFS         // Mac HFS seconds since 1904
 )
 
 func (t Type) Resolve(options *Options) Type {
@@ -64,6 +93,11 @@ func (t Type) Resolve(options *Options) Type {
 }
 
 func (t Type) String() string {
+	if t.isFixed() {
+		return t.fixedName()
+	} else if t.isBCD() {
+		return t.bcdName()
+	}
 	return typeNames[t]
 }
 
@@ -73,13 +107,31 @@ func (t Type) Size() int {
 		panic("Size_t/Off_t types must be converted to another type using options.PtrSize")
 	case Pad, String, Int8, Uint8, Bool:
 		return 1
-	case Int16, Uint16:
+	case Unix32, DOSDateTime, HFS:
+		return 4
+	case Unix64, UnixMs64, UnixNs64, NTP64, FileTime:
+		return 8
+	case Int16, Uint16, Binary16, BFloat16:
 		return 2
+	case Int24, Uint24:
+		return 3
 	case Int32, Uint32, Float32:
 		return 4
+	case Int40, Uint40:
+		return 5
+	case Int48, Uint48:
+		return 6
+	case Int56, Uint56:
+		return 7
 	case Int64, Uint64, Float64:
 		return 8
 	default:
+		if t.isFixed() {
+			_, intBits, fracBits := t.fixedFormat()
+			return int(intBits+fracBits) / 8
+		} else if t.isBCD() {
+			return t.bcdSize()
+		}
 		panic("Cannot resolve size of type:" + t.String())
 	}
 }
@@ -99,12 +151,38 @@ var typeLookup = map[string]Type{
 	"float32": Float32,
 	"float64": Float64,
 
+	"float16":  Binary16,
+	"bfloat16": BFloat16,
+
+	"unix32":      Unix32,
+	"unix64":      Unix64,
+	"unixms64":    UnixMs64,
+	"unixns64":    UnixNs64,
+	"ntp64":       NTP64,
+	"filetime":    FileTime,
+	"dosdatetime": DOSDateTime,
+	"hfs":         HFS,
+
+	"uvarint": Uvarint,
+	"varint":  Varint,
+	"sleb128": Sleb128,
+
+	"int24":  Int24,
+	"uint24": Uint24,
+	"int40":  Int40,
+	"uint40": Uint40,
+	"int48":  Int48,
+	"uint48": Uint48,
+	"int56":  Int56,
+	"uint56": Uint56,
+
 	"size_t": SizeType,
 	"off_t":  OffType,
 }
 
 var typeNames = map[Type]string{
 	CustomType: "Custom",
+	Union:      "Union",
 }
 
 func init() {
@@ -0,0 +1,197 @@
+package struc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// unionType holds the concrete types registered for an interface type,
+// keyed by the discriminator value that selects them.
+type unionType struct {
+	iface  reflect.Type
+	types  map[uint64]reflect.Type
+	values map[reflect.Type]uint64
+}
+
+var unionRegistry = make(map[reflect.Type]*unionType)
+var unionLock sync.RWMutex
+
+// unionKey identifies the fields of a concrete union type parsed with the
+// byte order of the struct holding the union.
+type unionKey struct {
+	typ   reflect.Type
+	order binary.ByteOrder
+}
+
+var unionFieldCache = make(map[unionKey]Fields)
+
+// RegisterUnion registers the concrete types that may be stored in
+// interface fields tagged with `union=Field`. iface is a nil pointer to the
+// interface type, such as (*Body)(nil), and types maps each discriminator
+// value to a sample of the concrete type it selects:
+//
+//	struc.RegisterUnion((*Body)(nil), map[uint64]interface{}{1: LoginReq{}, 2: &DataReq{}})
+//
+// Unpack allocates values of the sample's type; if only a pointer to the
+// sample implements iface, a pointer is allocated instead. RegisterUnion
+// panics if iface is not a pointer to an interface or a sample does not
+// implement it. Registering the same interface again replaces its types,
+// which takes effect on the next Pack or Unpack.
+func RegisterUnion(iface interface{}, types map[uint64]interface{}) {
+	t := reflect.TypeOf(iface)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Interface {
+		panic(fmt.Sprintf("struc: RegisterUnion expects a nil pointer to an interface, got %T", iface))
+	}
+	u := &unionType{
+		iface:  t.Elem(),
+		types:  make(map[uint64]reflect.Type, len(types)),
+		values: make(map[reflect.Type]uint64, len(types)),
+	}
+	for value, sample := range types {
+		typ := reflect.TypeOf(sample)
+		if typ == nil {
+			panic(fmt.Sprintf("struc: RegisterUnion got a nil type for discriminator %d", value))
+		}
+		if !typ.Implements(u.iface) {
+			if typ.Kind() == reflect.Ptr || !reflect.PtrTo(typ).Implements(u.iface) {
+				panic(fmt.Sprintf("struc: %s does not implement %s", typ, u.iface))
+			}
+			typ = reflect.PtrTo(typ)
+		}
+		if prev, ok := u.values[typ]; ok {
+			panic(fmt.Sprintf("struc: %s is registered for both discriminators %d and %d", typ, prev, value))
+		}
+		u.types[value] = typ
+		u.values[typ] = value
+	}
+	unionLock.Lock()
+	unionRegistry[u.iface] = u
+	unionLock.Unlock()
+}
+
+func unionLookup(t reflect.Type) *unionType {
+	unionLock.RLock()
+	defer unionLock.RUnlock()
+	return unionRegistry[t]
+}
+
+// unionFields returns the fields of the concrete union type typ, which
+// default to order like the fields of a nested struct.
+func unionFields(typ reflect.Type, order binary.ByteOrder) (Fields, error) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	key := unionKey{typ, order}
+	unionLock.RLock()
+	fields, ok := unionFieldCache[key]
+	unionLock.RUnlock()
+	if ok {
+		return fields, nil
+	}
+	parseLock.Lock()
+	fields, err := parseFieldsLocked(reflect.New(typ), order)
+	parseLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	unionLock.Lock()
+	unionFieldCache[key] = fields
+	unionLock.Unlock()
+	return fields, nil
+}
+
+// discriminant returns the value of an integer discriminator field.
+func discriminant(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int())
+	default:
+		return v.Uint()
+	}
+}
+
+// unionValue returns the discriminator value for the concrete type held in
+// the union field f, or an error if the type was never registered.
+func (f *Field) unionValue(v reflect.Value) (uint64, error) {
+	typ := v.Elem().Type()
+	n, ok := unionLookup(f.union).values[typ]
+	if !ok {
+		return 0, fmt.Errorf("struc: type %s is not registered for union field %s", typ, f.Name)
+	}
+	return n, nil
+}
+
+// unionElem returns an addressable copy of the value held in the union field
+// f along with its parsed fields.
+func (f *Field) unionElem(v reflect.Value) (reflect.Value, Fields, error) {
+	if v.IsNil() {
+		return reflect.Value{}, nil, fmt.Errorf("struc: union field %s is nil", f.Name)
+	}
+	elem := v.Elem()
+	if elem.Kind() != reflect.Ptr {
+		tmp := reflect.New(elem.Type()).Elem()
+		tmp.Set(elem)
+		elem = tmp
+	}
+	fields, err := unionFields(elem.Type(), f.Order)
+	return elem, fields, err
+}
+
+// packDiscriminator checks the discriminator field against the dynamic type
+// of the union it selects. A zero discriminator is filled in from the type.
+func (f Fields) packDiscriminator(val reflect.Value, field *Field, v reflect.Value) (reflect.Value, error) {
+	union := val.FieldByIndex(field.unionOf)
+	if union.IsNil() {
+		return v, nil
+	}
+	want, err := f[field.unionOf[0]].unionValue(union)
+	if err != nil {
+		return v, err
+	}
+	got := discriminant(v)
+	if got == want {
+		return v, nil
+	} else if got != 0 {
+		return v, fmt.Errorf("struc: discriminator %s is %d but union field %s holds %s (%d)",
+			field.Name, got, f[field.unionOf[0]].Name, union.Elem().Type(), want)
+	}
+	v = reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(want))
+	default:
+		v.SetUint(want)
+	}
+	return v, nil
+}
+
+// unpackUnion allocates the concrete type selected by the discriminator of
+// the union field and unpacks into it.
+func (f Fields) unpackUnion(r io.Reader, val reflect.Value, field *Field, options *Options) error {
+	n := discriminant(val.FieldByIndex(field.unionFrom))
+	typ, ok := unionLookup(field.union).types[n]
+	if !ok {
+		return fmt.Errorf("struc: no type registered for discriminator %d of union field %s", n, field.Name)
+	}
+	var elem reflect.Value
+	if typ.Kind() == reflect.Ptr {
+		elem = reflect.New(typ.Elem())
+	} else {
+		elem = reflect.New(typ)
+	}
+	fields, err := unionFields(typ, field.Order)
+	if err != nil {
+		return err
+	}
+	if err := fields.Unpack(r, elem, options); err != nil {
+		return err
+	}
+	if typ.Kind() != reflect.Ptr {
+		elem = elem.Elem()
+	}
+	val.Field(field.Index).Set(elem)
+	return nil
+}
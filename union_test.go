@@ -0,0 +1,191 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type unionBody interface {
+	isUnionBody()
+}
+
+type loginReq struct {
+	User string `struc:"[4]byte"`
+}
+
+func (loginReq) isUnionBody() {}
+
+type dataReq struct {
+	Len  int `struc:"uint8,sizeof=Data"`
+	Data []byte
+}
+
+func (*dataReq) isUnionBody() {}
+
+func init() {
+	RegisterUnion((*unionBody)(nil), map[uint64]interface{}{
+		1: loginReq{},
+		2: dataReq{},
+	})
+}
+
+type unionMsg struct {
+	MsgType uint8
+	Body    unionBody `struc:"union=MsgType"`
+	Tail    uint8
+}
+
+func TestUnion(t *testing.T) {
+	tests := []struct {
+		in    *unionMsg
+		bytes []byte
+	}{
+		{&unionMsg{1, loginReq{"root"}, 9}, []byte{1, 'r', 'o', 'o', 't', 9}},
+		{&unionMsg{2, &dataReq{2, []byte("hi")}, 9}, []byte{2, 2, 'h', 'i', 9}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := Pack(&buf, test.in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), test.bytes) {
+			t.Errorf("got: %#v\nwant: %#v", buf.Bytes(), test.bytes)
+		}
+		if size, _ := Sizeof(test.in); size != len(test.bytes) {
+			t.Errorf("sizeof failed; expected %d, got %d", len(test.bytes), size)
+		}
+		out := &unionMsg{}
+		if err := Unpack(&buf, out); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, test.in) {
+			t.Errorf("got: %#v\nwant: %#v", out, test.in)
+		}
+	}
+}
+
+func TestUnionFillDiscriminator(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, &unionMsg{Body: &dataReq{Data: []byte("x")}}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{2, 1, 'x', 0}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+}
+
+func TestUnionErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, &unionMsg{MsgType: 1, Body: &dataReq{}}); err == nil {
+		t.Fatal("failed to error on mismatched discriminator")
+	}
+	if err := Pack(&buf, &unionMsg{MsgType: 1}); err == nil {
+		t.Fatal("failed to error on nil union")
+	}
+	if err := Unpack(bytes.NewReader([]byte{3, 0}), &unionMsg{}); err == nil {
+		t.Fatal("failed to error on unknown discriminator")
+	}
+}
+
+type reregisteredBody interface{}
+
+type reregisteredMsg struct {
+	Type uint8
+	Body reregisteredBody `struc:"union=Type"`
+}
+
+func TestUnionReregister(t *testing.T) {
+	RegisterUnion((*reregisteredBody)(nil), map[uint64]interface{}{1: loginReq{}})
+	var buf bytes.Buffer
+	if err := Pack(&buf, &reregisteredMsg{Body: loginReq{"root"}}); err != nil {
+		t.Fatal(err)
+	}
+	RegisterUnion((*reregisteredBody)(nil), map[uint64]interface{}{2: loginReq{}})
+	buf.Reset()
+	if err := Pack(&buf, &reregisteredMsg{Body: loginReq{"root"}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{2, 'r', 'o', 'o', 't'}; !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	if err := Unpack(bytes.NewReader([]byte{1, 'r', 'o', 'o', 't'}), &reregisteredMsg{}); err == nil {
+		t.Fatal("unpacked a discriminator that is no longer registered")
+	}
+}
+
+type orderBody interface{}
+
+type orderLogin struct {
+	ID uint16
+}
+
+type bigUnionMsg struct {
+	_    BigEndian
+	Type uint8
+	Body orderBody `struc:"union=Type"`
+}
+
+type littleUnionMsg struct {
+	Type uint8
+	Body orderBody `struc:"union=Type"`
+}
+
+func TestUnionByteOrder(t *testing.T) {
+	RegisterUnion((*orderBody)(nil), map[uint64]interface{}{1: orderLogin{}})
+	// the same type takes the order of each message holding it
+	for _, test := range []struct {
+		in, out interface{}
+		want    []byte
+	}{
+		{&bigUnionMsg{Body: orderLogin{1}}, &bigUnionMsg{}, []byte{1, 0, 1}},
+		{&littleUnionMsg{Body: orderLogin{1}}, &littleUnionMsg{}, []byte{1, 1, 0}},
+	} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, test.in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), test.want) {
+			t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), test.want)
+		}
+		if err := Unpack(&buf, test.out); err != nil {
+			t.Fatal(err)
+		}
+		if got := reflect.ValueOf(test.out).Elem().FieldByName("Body").Interface(); got != (orderLogin{1}) {
+			t.Fatalf("got: %#v\nwant: %#v", got, orderLogin{1})
+		}
+	}
+}
+
+type unionHeader struct {
+	Type uint8
+}
+
+type nestedDiscriminator struct {
+	unionHeader
+	Body unionBody `struc:"union=Type"`
+}
+
+type unregisteredUnion struct {
+	Type uint8
+	Body interface{} `struc:"union=Type"`
+}
+
+func TestUnionUnregistered(t *testing.T) {
+	if err := parseTest(&unregisteredUnion{}); err == nil {
+		t.Fatal("failed to error on unregistered union interface")
+	}
+	if err := parseTest(&nestedDiscriminator{}); err == nil {
+		t.Fatal("failed to error on a discriminator in an embedded struct")
+	}
+}
+
+func TestRegisterUnionPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("failed to panic on a type not implementing the union interface")
+		}
+	}()
+	RegisterUnion((*unionBody)(nil), map[uint64]interface{}{1: 0})
+}
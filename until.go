@@ -0,0 +1,216 @@
+package struc
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// terminator ends a slice tagged with `until=`. On Unpack, elements are read
+// until one matches, and on Pack the terminator is appended to the slice.
+type terminator struct {
+	src   string
+	value reflect.Value // the element packed to end the slice
+	cond  *expr         // matches struct terminators; nil compares with value
+	zero  bool          // match any zero element
+	keep  bool          // keep the terminator as the last element
+}
+
+// parseTerminator parses the `until=` tag of a slice of type t. The spec is
+// `zero` for an all-zero element, an integer literal for integer elements,
+// or for struct elements a condition such as `Type==0xFF`, which may join
+// several `Field==N` tests with `&&`.
+func parseTerminator(spec string, keep bool, t reflect.Type) (*terminator, error) {
+	elem := t.Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	term := &terminator{src: spec, value: reflect.New(elem).Elem(), keep: keep}
+	if spec == "zero" {
+		term.zero = true
+		return term, nil
+	}
+	if elem.Kind() != reflect.Struct {
+		if _, ok := intValue(term.value, 0); !ok {
+			return nil, fmt.Errorf("struc: `until=%s` needs integer or struct elements, not %s", spec, elem)
+		}
+		v, err := parseConst(spec, elem)
+		if err != nil {
+			return nil, fmt.Errorf("struc: invalid `until=%s` for %s", spec, t)
+		}
+		term.value = v
+		return term, nil
+	}
+	cond, err := parseExpr(spec, elem)
+	if err != nil {
+		return nil, err
+	}
+	// build the terminator to pack from the equality tests
+	var build func(n exprNode) bool
+	build = func(n exprNode) bool {
+		b, ok := n.(*exprBinary)
+		if !ok {
+			return false
+		}
+		if b.op == "&&" {
+			return build(b.x) && build(b.y)
+		}
+		x, isField := b.x.(*exprField)
+		c, isConst := b.y.(exprConst)
+		if b.op != "==" || !isField || !isConst {
+			return false
+		}
+		v, ok := intValue(term.value.FieldByIndex(x.index), int64(c))
+		if !ok {
+			return false
+		}
+		term.value.FieldByIndex(x.index).Set(v)
+		return true
+	}
+	if !build(cond.root) {
+		return nil, fmt.Errorf("struc: `until=%s` must be `zero` or `Field==N` tests joined by `&&`", spec)
+	}
+	term.cond = cond
+	return term, nil
+}
+
+func (t *terminator) String() string {
+	return t.src
+}
+
+// match reports whether elem ends the slice.
+func (t *terminator) match(elem reflect.Value) bool {
+	for elem.Kind() == reflect.Ptr {
+		if elem.IsNil() {
+			return false
+		}
+		elem = elem.Elem()
+	}
+	if t.cond != nil {
+		return t.cond.eval(elem) != 0
+	} else if t.zero {
+		return isZero(elem)
+	}
+	return reflect.DeepEqual(elem.Interface(), t.value.Interface())
+}
+
+// isZero reports whether v holds the zero value of its type, counting empty
+// slices and maps as zero.
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Slice, reflect.Map, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil() || isZero(v.Elem())
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !isZero(v.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !isZero(v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// check returns an error if an element of the slice v would end it early on
+// Unpack. Only the last element may match the terminator, and only when it
+// is kept.
+func (t *terminator) check(v reflect.Value, name string) error {
+	for i := 0; i < v.Len(); i++ {
+		if t.match(v.Index(i)) && (i < v.Len()-1 || !t.keep) {
+			return fmt.Errorf("struc: element %d of field `%s` matches its terminator `until=%s`", i, name, t.src)
+		}
+	}
+	return nil
+}
+
+// appended reports whether Pack adds the terminator after the slice v, which
+// it skips when the slice already ends with one it should keep.
+func (t *terminator) appended(v reflect.Value) bool {
+	return !t.keep || v.Len() == 0 || !t.match(v.Index(v.Len()-1))
+}
+
+// termSize returns the encoded size of the terminator Pack appends to v.
+func (f *Field) termSize(v reflect.Value, options *Options) int {
+	if !f.until.appended(v) {
+		return 0
+	}
+	if f.Type == Struct {
+		return f.Fields.Sizeof(f.until.value, options)
+	} else if f.Type.isVarint() {
+		return varintLen(f.Type, varintBits(f.until.value))
+	}
+	return f.Type.Resolve(options).Size()
+}
+
+// packTerm packs the terminator after the slice v.
+func (f *Field) packTerm(buf []byte, v reflect.Value, options *Options) (int, error) {
+	if !f.until.appended(v) {
+		return 0, nil
+	}
+	if f.Type == Struct {
+		return f.Fields.Pack(buf, f.until.value, options)
+	}
+	return f.packVal(buf, f.until.value, 1, options)
+}
+
+// unpackUntil unpacks the `until=` field one element at a time until its
+// terminator is read.
+func (f Fields) unpackUntil(r *reader, val reflect.Value, field *Field, options *Options) error {
+	v := val.Field(field.Index)
+	vals := reflect.MakeSlice(v.Type(), 0, 0)
+	typ := field.Type.Resolve(options)
+	for {
+		elem := reflect.New(v.Type().Elem()).Elem()
+		var err error
+		if typ == Struct {
+			e := elem
+			if e.Kind() == reflect.Ptr {
+				e.Set(reflect.New(e.Type().Elem()))
+			}
+			err = field.Fields.Unpack(r, e, options)
+		} else if typ.isVarint() {
+			var n uint64
+			if n, err = readVarint(r, typ); err == nil {
+				err = field.setVarint(elem, n)
+			}
+		} else {
+			buf := r.tmp[:typ.Size()]
+			if _, err = io.ReadFull(r, buf); err == nil {
+				err = field.unpackVal(buf, elem, 1, options)
+			}
+		}
+		if err == io.EOF {
+			// the stream ended before the terminator
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		done := field.until.match(elem)
+		if !done || field.until.keep {
+			vals = reflect.Append(vals, elem)
+		}
+		if done {
+			break
+		}
+	}
+	v.Set(vals)
+	return nil
+}
@@ -0,0 +1,102 @@
+package struc
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+type dirEntry struct {
+	Type uint8
+	Len  uint8 `struc:"sizeof=Name"`
+	Name []byte
+}
+
+type untilStruct struct {
+	Entries []dirEntry  `struc:"until=Type==0xFF"`
+	Options []uint16    `struc:"[]uint16,big,until=zero"`
+	Symbols []*dirEntry `struc:"until=zero,keepterm"`
+	Tail    uint8
+}
+
+func TestUntil(t *testing.T) {
+	in := &untilStruct{
+		Entries: []dirEntry{{1, 0, []byte("a")}, {2, 0, []byte("bc")}},
+		Options: []uint16{0x0102},
+		Symbols: []*dirEntry{{3, 0, []byte("d")}},
+		Tail:    9,
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		1, 1, 'a', 2, 2, 'b', 'c', 0xff, 0,
+		1, 2, 0, 0,
+		3, 1, 'd', 0, 0,
+		9,
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	out := &untilStruct{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	in.Entries[0].Len, in.Entries[1].Len, in.Symbols[0].Len = 1, 2, 1
+	in.Symbols = append(in.Symbols, &dirEntry{})
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %#v\nwant: %#v", out, in)
+	}
+	// a kept terminator is not packed twice
+	out.Symbols[1].Name = []byte{}
+	buf.Reset()
+	if err := Pack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+}
+
+func TestUntilPackTerminator(t *testing.T) {
+	for _, in := range []*untilStruct{
+		// a terminator before the end would cut the slice short
+		{Entries: []dirEntry{{1, 0, nil}, {0xff, 0, nil}, {2, 0, nil}}},
+		{Options: []uint16{1, 0, 2}},
+		{Symbols: []*dirEntry{{}, {3, 0, []byte("d")}}},
+		// a final terminator is only packed as is with keepterm
+		{Entries: []dirEntry{{1, 0, nil}, {0xff, 0, nil}}},
+		{Options: []uint16{1, 0}},
+	} {
+		if err := Pack(&bytes.Buffer{}, in); err == nil {
+			t.Errorf("%+v: packed without error", in)
+		}
+	}
+	// a kept terminator may end the slice
+	if err := Pack(&bytes.Buffer{}, &untilStruct{Symbols: []*dirEntry{{3, 0, []byte("d")}, {}}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUntilErrors(t *testing.T) {
+	err := Unpack(bytes.NewReader([]byte{1, 1, 'a'}), &untilStruct{})
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	type notEqual struct {
+		Entries []dirEntry `struc:"until=Type>3"`
+	}
+	type badConst struct {
+		Data []uint8 `struc:"until=256"`
+	}
+	type array struct {
+		Data [4]uint8 `struc:"until=zero"`
+	}
+	for _, v := range []interface{}{&notEqual{}, &badConst{}, &array{}} {
+		if err := Pack(&bytes.Buffer{}, v); err == nil {
+			t.Errorf("%T: failed to reject bad until= tag", v)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package struc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// isVarint reports whether t is a LEB128 type, whose size depends on its value.
+func (t Type) isVarint() bool {
+	return t == Uvarint || t == Varint || t == Sleb128
+}
+
+func zigzag(n uint64) uint64 {
+	return uint64(int64(n)<<1 ^ int64(n)>>63)
+}
+
+func unzigzag(n uint64) uint64 {
+	return uint64(int64(n>>1) ^ -int64(n&1))
+}
+
+// varintLen returns the encoded size of n as a varint of type typ. For the
+// signed types n holds the bits of an int64.
+func varintLen(typ Type, n uint64) int {
+	size := 1
+	switch typ {
+	case Sleb128:
+		for x := int64(n); x < -64 || x >= 64; x >>= 7 {
+			size++
+		}
+		return size
+	case Varint:
+		n = zigzag(n)
+	}
+	for ; n >= 0x80; n >>= 7 {
+		size++
+	}
+	return size
+}
+
+// putVarint encodes n into buf as a varint of type typ, returning the number
+// of bytes written.
+func putVarint(buf []byte, typ Type, n uint64) int {
+	switch typ {
+	case Sleb128:
+		x := int64(n)
+		for i := 0; ; i++ {
+			b := byte(x & 0x7f)
+			x >>= 7
+			if (x == 0 && b&0x40 == 0) || (x == -1 && b&0x40 != 0) {
+				buf[i] = b
+				return i + 1
+			}
+			buf[i] = b | 0x80
+		}
+	case Varint:
+		n = zigzag(n)
+	}
+	return binary.PutUvarint(buf, n)
+}
+
+// readVarint reads a varint of type typ from r one byte at a time.
+func readVarint(r *reader, typ Type) (uint64, error) {
+	var n uint64
+	var shift uint
+	b := r.tmp[:1]
+	for i := 0; ; i++ {
+		if _, err := io.ReadFull(r, b); err != nil {
+			if err == io.EOF && i > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		// the tenth byte holds the last bit of 64
+		if i == 9 && b[0] > 1 && !(typ == Sleb128 && b[0] == 0x7f) {
+			return 0, fmt.Errorf("struc: %s overflows 64 bits", typ)
+		}
+		n |= uint64(b[0]&0x7f) << shift
+		shift += 7
+		if b[0] < 0x80 {
+			if typ == Sleb128 && shift < 64 && b[0]&0x40 != 0 {
+				n |= ^uint64(0) << shift
+			} else if typ == Varint {
+				n = unzigzag(n)
+			}
+			return n, nil
+		}
+	}
+}
+
+// varintBits returns the bits of the bool or integer val.
+func varintBits(val reflect.Value) uint64 {
+	switch val.Kind() {
+	case reflect.Bool:
+		if val.Bool() {
+			return 1
+		}
+		return 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(val.Int())
+	default:
+		return val.Uint()
+	}
+}
+
+// varintSize returns the encoded size of the varint field val, holding length
+// elements if it is a slice.
+func (f *Field) varintSize(val reflect.Value, length int) int {
+	if f.Ptr {
+		val = val.Elem()
+	}
+	if !f.Slice {
+		return varintLen(f.Type, varintBits(val))
+	}
+	size := 0
+	for i := 0; i < length; i++ {
+		if i < val.Len() {
+			size += varintLen(f.Type, varintBits(val.Index(i)))
+		} else {
+			// missing elements are packed as zero
+			size++
+		}
+	}
+	return size
+}
+
+// packVarint packs val as a varint into buf.
+func (f *Field) packVarint(buf []byte, val reflect.Value) (int, error) {
+	n := varintBits(val)
+	switch val.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if f.Type != Uvarint && n > math.MaxInt64 {
+			return 0, fmt.Errorf("struc: value %d of field %s overflows %s", n, f.Name, f.Type)
+		}
+	}
+	return putVarint(buf, f.Type, n), nil
+}
+
+// setVarint stores n, read as a varint of the field's type, in val.
+func (f *Field) setVarint(val reflect.Value, n uint64) error {
+	signed := f.Type != Uvarint
+	switch val.Kind() {
+	case reflect.Bool:
+		val.SetBool(n != 0)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if (signed || n <= math.MaxInt64) && !val.OverflowInt(int64(n)) {
+			val.SetInt(int64(n))
+			return nil
+		}
+	default:
+		if (!signed || int64(n) >= 0) && !val.OverflowUint(n) {
+			val.SetUint(n)
+			return nil
+		}
+	}
+	if signed {
+		return fmt.Errorf("struc: %s value %d overflows field %s", f.Type, int64(n), f.Name)
+	}
+	return fmt.Errorf("struc: %s value %d overflows field %s", f.Type, n, f.Name)
+}
+
+// unpackVarint unpacks the varint field val, holding length elements if it
+// is a slice.
+func (f *Field) unpackVarint(r *reader, val reflect.Value, length int) error {
+	if !f.Slice {
+		if f.Ptr {
+			val = val.Elem()
+		}
+		n, err := readVarint(r, f.Type)
+		if err != nil {
+			return err
+		}
+		return f.setVarint(val, n)
+	}
+	if !f.Array {
+		val.Set(reflect.MakeSlice(val.Type(), length, length))
+	}
+	for i := 0; i < length; i++ {
+		n, err := readVarint(r, f.Type)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if err := f.setVarint(val.Index(i), n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unpackVarints unpacks varints from r into the slice val until r is
+// exhausted, for `bytesizefrom=` and `rest` fields.
+func (f *Field) unpackVarints(r *reader, val reflect.Value, end int64) error {
+	vals := reflect.MakeSlice(val.Type(), 0, 0)
+	for r.pos < end {
+		elem := reflect.New(val.Type().Elem()).Elem()
+		n, err := readVarint(r, f.Type)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if err := f.setVarint(elem, n); err != nil {
+			return err
+		}
+		vals = reflect.Append(vals, elem)
+	}
+	val.Set(vals)
+	return nil
+}
@@ -0,0 +1,152 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type varintScalars struct {
+	U uint64 `struc:"uvarint"`
+	V int32  `struc:"varint"`
+	S int64  `struc:"sleb128"`
+	B bool   `struc:"uvarint"`
+	N int16  `struc:"big"`
+}
+
+func TestVarintScalars(t *testing.T) {
+	for _, test := range []struct {
+		in   varintScalars
+		want []byte
+	}{
+		{varintScalars{0, 0, 0, false, 1}, []byte{0, 0, 0, 0, 0, 1}},
+		{varintScalars{300, -1, -123456, true, 2}, []byte{0xac, 0x02, 0x01, 0xc0, 0xbb, 0x78, 1, 0, 2}},
+		{varintScalars{1<<64 - 1, 64, 63, false, 3}, []byte{
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01,
+			0x80, 0x01, 0x3f, 0, 0, 3}},
+		{varintScalars{127, -64, 64, false, 4}, []byte{0x7f, 0x7f, 0xc0, 0x00, 0, 0, 4}},
+	} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, &test.in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), test.want) {
+			t.Fatalf("%+v: got: %#v\nwant: %#v", test.in, buf.Bytes(), test.want)
+		}
+		if size, _ := Sizeof(&test.in); size != len(test.want) {
+			t.Fatalf("%+v: bad size %d", test.in, size)
+		}
+		out := varintScalars{}
+		if err := Unpack(bytes.NewReader(test.want), &out); err != nil {
+			t.Fatal(err)
+		}
+		if out != test.in {
+			t.Fatalf("got: %+v\nwant: %+v", out, test.in)
+		}
+	}
+}
+
+type varintSlices struct {
+	Count  int      `struc:"uvarint,sizeof=Values"`
+	Values []int    `struc:"[]sleb128"`
+	Bytes  int      `struc:"uvarint,bytesizeof=Packed"`
+	Packed []uint32 `struc:"[]uvarint"`
+	Fixed  [2]int16 `struc:"[2]varint"`
+	Rest   []uint16 `struc:"[]uvarint,rest"`
+}
+
+func TestVarintSlices(t *testing.T) {
+	in := &varintSlices{
+		Values: make([]int, 130),
+		Packed: []uint32{1, 128, 1 << 20},
+		Fixed:  [2]int16{-2, 2},
+		Rest:   []uint16{0xffff, 5},
+	}
+	for i := range in.Values {
+		in.Values[i] = i - 65
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	// 130 elements need a two byte count, and -65 and 64 two bytes each
+	want := []byte{0x82, 0x01}
+	for _, v := range in.Values {
+		var tmp [10]byte
+		want = append(want, tmp[:putVarint(tmp[:], Sleb128, uint64(v))]...)
+	}
+	want = append(want, 6, 0x01, 0x80, 0x01, 0x80, 0x80, 0x40, 0x03, 0x04, 0xff, 0xff, 0x03, 0x05)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	if size, _ := Sizeof(in); size != len(want) {
+		t.Fatalf("bad size %d, want %d", size, len(want))
+	}
+	out := &varintSlices{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	in.Count, in.Bytes = 130, 6
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %+v\nwant: %+v", out, in)
+	}
+}
+
+type varintUntil struct {
+	Values []uint `struc:"[]uvarint,until=0"`
+}
+
+func TestVarintUntil(t *testing.T) {
+	in := &varintUntil{[]uint{300, 1}}
+	want := []byte{0xac, 0x02, 0x01, 0x00}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v", buf.Bytes())
+	}
+	out := &varintUntil{}
+	if err := Unpack(bytes.NewReader(want), out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got: %+v", out)
+	}
+}
+
+func TestVarintErrors(t *testing.T) {
+	type small struct {
+		A uint8 `struc:"uvarint"`
+	}
+	type signed struct {
+		A uint64 `struc:"sleb128"`
+	}
+	for _, test := range []struct {
+		data interface{}
+		in   []byte
+	}{
+		// 300 does not fit a uint8
+		{&small{}, []byte{0xac, 0x02}},
+		// -1 does not fit a uint64
+		{&signed{}, []byte{0x7f}},
+		// more than 64 bits
+		{&small{}, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02}},
+		// truncated
+		{&small{}, []byte{0x80}},
+	} {
+		if err := Unpack(bytes.NewReader(test.in), test.data); err == nil {
+			t.Fatalf("%#v: unpacked without error", test.in)
+		}
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, &signed{1 << 63}); err == nil {
+		t.Fatal("packed an overflowing sleb128 without error")
+	}
+	type str struct {
+		A string `struc:"uvarint"`
+	}
+	if err := parseTest(&str{}); err == nil {
+		t.Fatal("parsed a string varint without error")
+	}
+}
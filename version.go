@@ -0,0 +1,22 @@
+package struc
+
+import "reflect"
+
+// inVersion reports whether f is encoded in the format version held in
+// options, which is Options.Version until a `version` field sets it.
+func (f *Field) inVersion(options *Options) bool {
+	return (f.since == 0 || options.Version >= f.since) &&
+		(f.before == 0 || options.Version < f.before)
+}
+
+// setVersion returns options with Version set from the `version` field f,
+// whose value is v, for the rest of the struct and nested structs.
+func (f *Field) setVersion(v reflect.Value, options *Options) *Options {
+	n, _ := SizeFromField(v)
+	if n == options.Version {
+		return options
+	}
+	opts := *options
+	opts.Version = n
+	return &opts
+}
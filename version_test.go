@@ -0,0 +1,75 @@
+package struc
+
+import (
+	"bytes"
+	"testing"
+)
+
+type versionedExtra struct {
+	A uint8
+	B uint8 `struc:"since=4"`
+}
+
+type versionedRecord struct {
+	Version uint8 `struc:"uint8,version"`
+	Size    uint16
+	Flags   uint32 `struc:"uint32,since=3"`
+	Legacy  uint8  `struc:"before=5"`
+	Extra   versionedExtra
+}
+
+func TestVersionGates(t *testing.T) {
+	for _, test := range []struct {
+		version uint8
+		want    []byte
+	}{
+		{1, []byte{1, 2, 0, 4, 5}},
+		{3, []byte{3, 2, 0, 3, 0, 0, 0, 4, 5}},
+		{4, []byte{4, 2, 0, 3, 0, 0, 0, 4, 5, 6}},
+		{5, []byte{5, 2, 0, 3, 0, 0, 0, 5, 6}},
+	} {
+		in := &versionedRecord{test.version, 2, 3, 4, versionedExtra{5, 6}}
+		var buf bytes.Buffer
+		if err := Pack(&buf, in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), test.want) {
+			t.Fatalf("version %d: got: %#v\nwant: %#v", test.version, buf.Bytes(), test.want)
+		}
+		if size, _ := Sizeof(in); size != len(test.want) {
+			t.Fatalf("version %d: bad size %d", test.version, size)
+		}
+		out := &versionedRecord{}
+		if err := Unpack(bytes.NewReader(test.want), out); err != nil {
+			t.Fatal(err)
+		}
+		if out.Flags != 0 && test.version < 3 || out.Legacy != 0 && test.version >= 5 || out.Extra.A != 5 {
+			t.Fatalf("version %d: bad unpack: %#v", test.version, out)
+		}
+	}
+}
+
+func TestVersionOption(t *testing.T) {
+	// without a version field, Options.Version decides
+	in := &versionedExtra{5, 6}
+	var buf bytes.Buffer
+	if err := PackWithOptions(&buf, in, &Options{Version: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{5}) {
+		t.Fatalf("got: %#v", buf.Bytes())
+	}
+	out := &versionedExtra{}
+	if err := UnpackWithOptions(bytes.NewReader([]byte{5, 6}), out, &Options{Version: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if *out != *in {
+		t.Fatalf("got: %#v", out)
+	}
+	type empty struct {
+		A int `struc:"since=3,before=3"`
+	}
+	if err := Pack(&buf, &empty{}); err == nil {
+		t.Fatal("failed to reject an empty version range")
+	}
+}